@@ -0,0 +1,147 @@
+package plumber
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// build holds the kustomize output for an overlay and the hash of the filesystem from where
+// it was generated.
+type build struct {
+	hash      string
+	resources resmap.ResMap
+}
+
+// InvalidateCache drops all cached kustomize outputs, the next call to Render, Apply, Delete or
+// Diff runs kustomize again for every overlay. As cached outputs are keyed by the content of
+// the filesystem after all mutators have run this is only needed when kustomize depends on
+// something other than the files themselves.
+func (r *Renderer) InvalidateCache() {
+	r.cacheMtx.Lock()
+	defer r.cacheMtx.Unlock()
+	r.builds = map[string]build{}
+}
+
+// filesystem returns a filesys.FileSystem with the content of the Renderer fs.FS. If the fs.FS
+// is static (see static) its content is read only once and a copy of it is returned, other
+// fs.FS implementations (e.g. directories on disk) may change so they are read every time.
+func (r *Renderer) filesystem() (filesys.FileSystem, error) {
+	if !r.static() {
+		return LoadFS(r.from)
+	}
+
+	r.loadOnce.Do(func() {
+		r.loaded, r.loadErr = LoadFS(r.from)
+	})
+	if r.loadErr != nil {
+		return nil, r.loadErr
+	}
+	return clone(r.loaded)
+}
+
+// static returns true if the content of the Renderer fs.FS never changes. Embedded filesystems
+// are static by definition, other implementations must be flagged with WithStaticFS.
+func (r *Renderer) static() bool {
+	switch r.from.(type) {
+	case embed.FS, *embed.FS:
+		return true
+	default:
+		return r.staticFS
+	}
+}
+
+// kustomize runs kustomize for the provided overlay on top of the provided filesystem. Outputs
+// are cached per overlay and reused for as long as the content of the filesystem does not
+// change. Returns a copy of the cached output so callers are free to modify it.
+func (r *Renderer) kustomize(virtfs filesys.FileSystem, overlay string) (resmap.ResMap, error) {
+	hash, err := checksum(virtfs)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing filesystem: %w", err)
+	}
+
+	r.cacheMtx.Lock()
+	cached, ok := r.builds[overlay]
+	r.cacheMtx.Unlock()
+	if ok && cached.hash == hash {
+		return cached.resources.DeepCopy(), nil
+	}
+
+	res, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(
+		virtfs, path.Join("kustomize", overlay),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cacheMtx.Lock()
+	defer r.cacheMtx.Unlock()
+	if r.builds == nil {
+		r.builds = map[string]build{}
+	}
+	r.builds[overlay] = build{hash: hash, resources: res.DeepCopy()}
+	return res, nil
+}
+
+// clone returns an in memory copy of the provided filesystem.
+func clone(from filesys.FileSystem) (filesys.FileSystem, error) {
+	to := filesys.MakeFsInMemory()
+	if err := from.Walk("/", func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		content, err := from.ReadFile(fpath)
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+		return to.WriteFile(fpath, content)
+	}); err != nil {
+		return nil, fmt.Errorf("error copying filesystem: %w", err)
+	}
+	return to, nil
+}
+
+// checksum returns a hash of the paths and contents of all files in the provided filesystem.
+func checksum(virtfs filesys.FileSystem) (string, error) {
+	hash := sha256.New()
+	if err := virtfs.Walk("/", func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		content, err := virtfs.ReadFile(fpath)
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+
+		// we write the path and the content length so different
+		// layouts can't end up with the same hash.
+		header := fpath + "\x00" + strconv.Itoa(len(content)) + "\x00"
+		if _, err := io.WriteString(hash, header); err != nil {
+			return err
+		}
+		_, err = hash.Write(content)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
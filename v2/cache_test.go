@@ -0,0 +1,196 @@
+package plumber
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// embedded holds a base and an overlay named "overlay" under the testdata directory, see
+// embeddedFS.
+//
+//go:embed testdata/kustomize
+var embedded embed.FS
+
+// embeddedFS returns the embedded test filesystem rooted where the Renderer expects it.
+func embeddedFS(tb testing.TB) fs.FS {
+	sub, err := fs.Sub(embedded, "testdata")
+	if err != nil {
+		tb.Fatalf("unexpected error: %v", err)
+	}
+	return sub
+}
+
+// benchmarkFS returns the test filesystem with a number of extra ConfigMaps in the base so
+// kustomize has some work to do.
+func benchmarkFS(configmaps int) fstest.MapFS {
+	files := testFS()
+	resources := "resources:\n- deployment.yaml\n- service.yaml\n"
+	for i := 0; i < configmaps; i++ {
+		name := fmt.Sprintf("configmap-%d.yaml", i)
+		resources += fmt.Sprintf("- %s\n", name)
+		files["kustomize/base/"+name] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf(
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config-%d\n"+
+					"  namespace: default\ndata:\n  key: value-%d\n",
+				i, i,
+			)),
+		}
+	}
+	files["kustomize/base/kustomization.yaml"] = &fstest.MapFile{Data: []byte(resources)}
+	return files
+}
+
+func BenchmarkRender(b *testing.B) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name  string
+		cache bool
+	}{
+		{name: "cold", cache: false},
+		{name: "warm", cache: true},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			renderer := testRenderer(benchmarkFS(50))
+			if _, err := renderer.Render(ctx, "overlay"); err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !tt.cache {
+					renderer.InvalidateCache()
+				}
+
+				if _, err := renderer.Render(ctx, "overlay"); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestFilesystem(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		from   fs.FS
+		opts   []Option
+		static bool
+	}{
+		{
+			name:   "embed",
+			from:   embedded,
+			static: true,
+		},
+		{
+			name:   "embed pointer",
+			from:   &embedded,
+			static: true,
+		},
+		{
+			name: "embed sub",
+			from: embeddedFS(t),
+		},
+		{
+			name:   "embed sub with static fs",
+			from:   embeddedFS(t),
+			opts:   []Option{WithStaticFS()},
+			static: true,
+		},
+		{
+			name: "map",
+			from: testFS(),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := testRenderer(tt.from, tt.opts...)
+			first, err := renderer.filesystem()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if static := renderer.loaded != nil; static != tt.static {
+				t.Errorf("expected static %v, received %v", tt.static, static)
+			}
+
+			// each call must return its own copy, mutators are free
+			// to change it.
+			if err := first.WriteFile("mutated.yaml", []byte("x")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			second, err := renderer.filesystem()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if second.Exists("mutated.yaml") {
+				t.Errorf("changes to a returned filesystem leaked into the next one")
+			}
+		})
+	}
+}
+
+func BenchmarkRenderEmbed(b *testing.B) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "reload"},
+		{name: "once", opts: []Option{WithStaticFS()}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			renderer := testRenderer(embeddedFS(b), tt.opts...)
+			if _, err := renderer.Render(ctx, "overlay"); err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := renderer.Render(ctx, "overlay"); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFilesystem(b *testing.B) {
+	for _, tt := range []struct {
+		name string
+		from fs.FS
+		opts []Option
+	}{
+		{name: "embed", from: embedded},
+		{name: "embed sub", from: embeddedFS(b)},
+		{name: "embed sub with static fs", from: embeddedFS(b), opts: []Option{WithStaticFS()}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			renderer := testRenderer(tt.from, tt.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := renderer.filesystem(); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkChecksum(b *testing.B) {
+	virtfs, err := LoadFS(benchmarkFS(50))
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := checksum(virtfs); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package plumber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ConflictAction is what the Renderer should do with an object whose apply failed due to
+// conflicts with other field managers.
+type ConflictAction string
+
+const (
+	// ConflictForce applies the object again, forcing the ownership of the conflicting fields.
+	ConflictForce ConflictAction = "force"
+	// ConflictSkip leaves the object untouched, it is reported as skipped in the result.
+	ConflictSkip ConflictAction = "skip"
+	// ConflictFail fails the apply of the object with a ConflictError.
+	ConflictFail ConflictAction = "fail"
+)
+
+// ConflictPolicy decides what to do with an object whose apply failed due to conflicts with
+// other field managers. It may be called concurrently when the Renderer applies objects
+// concurrently.
+type ConflictPolicy func(context.Context, client.Object, *ConflictError) ConflictAction
+
+// FieldConflict is a field we attempted to apply but that is owned by another field manager.
+// Field is the path to the field (e.g. ".spec.replicas") and Manager the field manager that
+// owns it. Message is the message returned by the API server.
+type FieldConflict struct {
+	Field   string
+	Manager string
+	Message string
+}
+
+// ConflictError is returned when an object can't be applied because some of its fields are
+// owned by other field managers. Use errors.As to extract it from the errors returned by the
+// Renderer.
+type ConflictError struct {
+	Conflicts []FieldConflict
+	Err       error
+}
+
+// Error returns a message listing all conflicting fields and their managers.
+func (e *ConflictError) Error() string {
+	fields := make([]string, 0, len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		fields = append(fields, fmt.Sprintf("%s (%q)", conflict.Field, conflict.Manager))
+	}
+	return fmt.Sprintf("conflicts with other field managers: %s", strings.Join(fields, ", "))
+}
+
+// Unwrap returns the error returned by the API server.
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// conflictManager extracts the field manager name from a conflict cause message. Messages look
+// like: conflict with "kube-controller-manager" using apps/v1.
+var conflictManager = regexp.MustCompile(`conflicts? with "([^"]*)"`)
+
+// asConflict parses the causes of a server side apply conflict error into a ConflictError.
+// Returns nil if the error is not a field manager conflict.
+func asConflict(err error) *ConflictError {
+	var status apierrors.APIStatus
+	if err == nil || !errors.As(err, &status) || !apierrors.IsConflict(err) {
+		return nil
+	}
+
+	details := status.Status().Details
+	if details == nil {
+		return nil
+	}
+
+	var conflicts []FieldConflict
+	for _, cause := range details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+
+		conflict := FieldConflict{Field: cause.Field, Message: cause.Message}
+		if match := conflictManager.FindStringSubmatch(cause.Message); match != nil {
+			conflict.Manager = match[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return &ConflictError{Conflicts: conflicts, Err: err}
+}
+
+// conflictOf returns the ConflictError wrapped in the provided error, nil if there is none.
+func conflictOf(err error) *ConflictError {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return conflict
+	}
+	return nil
+}
+
+// skippedError is returned when an object has been deliberately left untouched.
+type skippedError struct {
+	reason string
+}
+
+// Error returns the reason why the object has been skipped.
+func (e *skippedError) Error() string {
+	return e.reason
+}
+
+// skipped returns the reason why an object has been skipped, if the error says so.
+func skipped(err error) (string, bool) {
+	var skip *skippedError
+	if errors.As(err, &skip) {
+		return skip.reason, true
+	}
+	return "", false
+}
+
+// resolveConflict asks the conflict policy what to do with an object whose apply failed with
+// the provided conflict. Returns the outcome of the forced apply, a skippedError or the
+// conflict itself.
+func (r *Renderer) resolveConflict(
+	ctx context.Context,
+	obj, applied client.Object,
+	conflict *ConflictError,
+	opts []client.PatchOption,
+) error {
+	action := ConflictFail
+	if r.conflictPolicy != nil {
+		action = r.conflictPolicy(ctx, obj, conflict)
+	}
+
+	switch action {
+	case ConflictForce:
+		forced := append([]client.PatchOption{client.ForceOwnership}, opts...)
+		return r.retry(ctx, func() error {
+			return r.cli.Patch(ctx, applied, client.Apply, forced...)
+		})
+	case ConflictSkip:
+		return &skippedError{reason: conflict.Error()}
+	default:
+		return conflict
+	}
+}
@@ -0,0 +1,171 @@
+package plumber
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestAsConflict(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	for _, tt := range []struct {
+		name     string
+		err      error
+		expected []FieldConflict
+	}{
+		{
+			name: "nil error",
+		},
+		{
+			name: "not a conflict",
+			err:  apierrors.NewNotFound(gr, "app"),
+		},
+		{
+			name: "resource version conflict",
+			err:  apierrors.NewConflict(gr, "app", errors.New("object has been modified")),
+		},
+		{
+			name: "single conflict",
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflict with "kubectl-client-side-apply" using apps/v1`,
+						Field:   ".spec.replicas",
+					},
+				},
+				`Apply failed with 1 conflict: conflict with "kubectl-client-side-apply" `+
+					`using apps/v1: .spec.replicas`,
+			),
+			expected: []FieldConflict{
+				{
+					Field:   ".spec.replicas",
+					Manager: "kubectl-client-side-apply",
+					Message: `conflict with "kubectl-client-side-apply" using apps/v1`,
+				},
+			},
+		},
+		{
+			name: "conflict with a subresource manager",
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflict with "x" with subresource "scale" using apps/v1`,
+						Field:   ".spec.replicas",
+					},
+				},
+				`Apply failed with 1 conflict: conflict with "x" with subresource "scale" `+
+					`using apps/v1: .spec.replicas`,
+			),
+			expected: []FieldConflict{
+				{
+					Field:   ".spec.replicas",
+					Manager: "x",
+					Message: `conflict with "x" with subresource "scale" using apps/v1`,
+				},
+			},
+		},
+		{
+			name: "multiple conflicts",
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflict with "helm" using apps/v1`,
+						Field:   ".spec.replicas",
+					},
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflicts with "kube-controller-manager" using apps/v1`,
+						Field:   `.spec.template.spec.containers[name="app"].image`,
+					},
+					{
+						Type:    metav1.CauseTypeFieldValueInvalid,
+						Message: "unrelated cause",
+						Field:   ".spec.selector",
+					},
+				},
+				"Apply failed with 2 conflicts",
+			),
+			expected: []FieldConflict{
+				{
+					Field:   ".spec.replicas",
+					Manager: "helm",
+					Message: `conflict with "helm" using apps/v1`,
+				},
+				{
+					Field:   `.spec.template.spec.containers[name="app"].image`,
+					Manager: "kube-controller-manager",
+					Message: `conflicts with "kube-controller-manager" using apps/v1`,
+				},
+			},
+		},
+		{
+			name: "unparsable manager",
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: "conflict with an unknown manager",
+						Field:   ".data.key",
+					},
+				},
+				"Apply failed with 1 conflict",
+			),
+			expected: []FieldConflict{
+				{
+					Field:   ".data.key",
+					Message: "conflict with an unknown manager",
+				},
+			},
+		},
+		{
+			name: "wrapped conflict",
+			err: fmt.Errorf("error applying: %w", apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflict with "helm" using v1`,
+						Field:   ".data.key",
+					},
+				},
+				"Apply failed with 1 conflict",
+			)),
+			expected: []FieldConflict{
+				{
+					Field:   ".data.key",
+					Manager: "helm",
+					Message: `conflict with "helm" using v1`,
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := asConflict(tt.err)
+			if tt.expected == nil {
+				if conflict != nil {
+					t.Fatalf("unexpected conflict: %v", conflict)
+				}
+				return
+			}
+
+			if conflict == nil {
+				t.Fatal("expected conflict, received nil")
+			}
+
+			if !reflect.DeepEqual(conflict.Conflicts, tt.expected) {
+				t.Errorf("expected %+v, received %+v", tt.expected, conflict.Conflicts)
+			}
+
+			if !apierrors.IsConflict(conflict) {
+				t.Errorf("expected conflict to wrap the api error")
+			}
+		})
+	}
+}
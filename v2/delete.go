@@ -0,0 +1,103 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultDeletionTimeout is how long we wait for each object to be gone when the Renderer is
+// configured with WithWaitForDeletion without a timeout.
+const DefaultDeletionTimeout = 2 * time.Minute
+
+// PendingDeletionError is returned when an object has been deleted but it is still present
+// after the deletion timeout. Finalizers are the finalizers the object still had by then, it
+// is common for objects to be held by a finalizer whose controller is gone.
+type PendingDeletionError struct {
+	Finalizers []string
+	Err        error
+}
+
+// Error returns the error message, including the pending finalizers.
+func (e *PendingDeletionError) Error() string {
+	if len(e.Finalizers) == 0 {
+		return fmt.Sprintf("object not deleted: %v", e.Err)
+	}
+
+	return fmt.Sprintf(
+		"object not deleted, pending finalizers %s: %v", strings.Join(e.Finalizers, ", "), e.Err,
+	)
+}
+
+// Unwrap returns the underlying error.
+func (e *PendingDeletionError) Unwrap() error {
+	return e.Err
+}
+
+// owned returns true if the provided live object has been applied by us. This is the case if
+// it carries our inventory label or if our field owner is among its field managers.
+func (r *Renderer) owned(live client.Object) bool {
+	if r.invName != "" && live.GetLabels()[InventoryLabel] == r.invName {
+		return true
+	}
+
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager == r.fieldOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteOptions returns the options to be used when deleting objects.
+func (r *Renderer) deleteOptions(dryRun bool) []client.DeleteOption {
+	var opts []client.DeleteOption
+	if r.propagation != nil {
+		opts = append(opts, client.PropagationPolicy(*r.propagation))
+	}
+	if dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+	return opts
+}
+
+// awaitDeletion waits until the provided object, already deleted, is gone. If the object is
+// still present after the deletion timeout its finalizers are removed, if the Renderer has
+// been configured to do so, and we wait once more. Returns a message describing the removed
+// finalizers, if any, or a PendingDeletionError.
+func (r *Renderer) awaitDeletion(ctx context.Context, obj client.Object) (string, error) {
+	werr := r.awaitGone(ctx, obj, r.deleteTimeout)
+	if werr == nil {
+		return "", nil
+	}
+
+	live, err := r.metadata(ctx, obj)
+	if err != nil {
+		return "", r.objectError(obj, PhaseRead, err)
+	}
+
+	if live == nil {
+		return "", nil
+	}
+
+	finalizers := live.GetFinalizers()
+	if !r.dropFinalizers || len(finalizers) == 0 {
+		return "", r.objectError(obj, PhaseWait, &PendingDeletionError{finalizers, werr})
+	}
+
+	patch := client.MergeFrom(live.DeepCopy())
+	live.SetFinalizers(nil)
+	if err := r.retry(ctx, func() error {
+		return r.cli.Patch(ctx, live, patch)
+	}); err != nil {
+		return "", r.objectError(obj, PhaseDelete, fmt.Errorf("error removing finalizers: %w", err))
+	}
+
+	if err := r.awaitGone(ctx, obj, r.deleteTimeout); err != nil {
+		return "", r.objectError(obj, PhaseWait, &PendingDeletionError{Err: err})
+	}
+	return fmt.Sprintf("finalizers removed: %s", strings.Join(finalizers, ", ")), nil
+}
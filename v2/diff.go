@@ -0,0 +1,221 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffAction is what would happen to an object if the overlay was applied.
+type DiffAction string
+
+const (
+	// DiffCreated means the object does not exist in the cluster and would be created.
+	DiffCreated DiffAction = "created"
+	// DiffChanged means the object exists in the cluster and would be changed.
+	DiffChanged DiffAction = "changed"
+	// DiffUnchanged means the object exists in the cluster and would be left untouched.
+	DiffUnchanged DiffAction = "unchanged"
+	// DiffConflict means the object can't be applied as is because some of its fields are owned
+	// by other field managers, see the diff Conflict. What Apply does depends on the conflict
+	// policy, which is not consulted when diffing.
+	DiffConflict DiffAction = "conflict"
+	// DiffRecreate means an immutable field has changed and the object is configured to be
+	// recreated (see WithRecreateOnImmutable), see the diff Err for the fields.
+	DiffRecreate DiffAction = "recreate"
+	// DiffError means the object can't be compared, most likely it would fail to be applied.
+	// See the diff Err. A common case is an object living in a Namespace that is part of the
+	// overlay but does not exist yet.
+	DiffError DiffAction = "error"
+)
+
+// ObjectDiff holds the comparison between a live object and the same object as the API server
+// would have persisted it after Apply. Diff is a unified diff between the YAML representation
+// of both versions and is empty if the object is unchanged. Managed fields and status are not
+// taken into account. Conflict is only set when Action is DiffConflict and Err is only set
+// when Action is DiffRecreate or DiffError.
+type ObjectDiff struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Action    DiffAction
+	Diff      string
+	Conflict  *ConflictError
+	Err       error
+}
+
+// Diff renders the provided overlay and compares each object with its live counterpart. The
+// comparison is made against the result of a server side apply dry-run so defaults, admission
+// webhooks and merges with fields owned by other managers are taken into account. Objects that
+// conflict with other field managers are reported as DiffConflict, objects that can't be
+// compared (e.g. the dry-run fails) are reported as DiffError or DiffRecreate. Only failures
+// rendering the overlay make Diff return an error. Nothing is changed in the cluster.
+func (r *Renderer) Diff(ctx context.Context, overlay string) ([]ObjectDiff, error) {
+	objs, sources, err := r.render(ctx, overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	ignored, err := r.ignoredFields(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	recreate, err := r.recreatable(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	op := &operation{
+		dryRun:   true,
+		diff:     true,
+		sources:  sources,
+		ignored:  ignored,
+		recreate: recreate,
+	}
+
+	var diffs []ObjectDiff
+	for _, obj := range objs {
+		diff, err := r.diff(ctx, op, obj)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// diff compares the live version of the provided object with the version returned by a server
+// side apply dry-run.
+func (r *Renderer) diff(ctx context.Context, op *operation, obj client.Object) (ObjectDiff, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return ObjectDiff{}, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	result := ObjectDiff{
+		GVK:       gvk,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+
+	if err := r.prepare(obj); err != nil {
+		result.Action = DiffError
+		result.Err = r.objectError(obj, PhaseMutate, err)
+		return result, nil
+	}
+
+	live, err := r.live(ctx, obj)
+	if err != nil {
+		result.Action = DiffError
+		result.Err = r.objectError(obj, PhaseRead, err)
+		return result, nil
+	}
+
+	if err := r.patch(ctx, op, obj); err != nil {
+		switch conflict := conflictOf(err); {
+		case conflict != nil:
+			result.Action = DiffConflict
+			result.Conflict = conflict
+		case op.recreate[obj] && immutable(err):
+			result.Action = DiffRecreate
+			result.Err = err
+		default:
+			result.Action = DiffError
+			result.Err = err
+		}
+		return result, nil
+	}
+
+	after, err := diffYAML(gvk, obj)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+
+	var before string
+	if live != nil {
+		if before, err = diffYAML(gvk, live); err != nil {
+			return ObjectDiff{}, err
+		}
+	}
+
+	name := path.Join(gvk.Kind, obj.GetNamespace(), obj.GetName())
+	udiff, err := difflib.GetUnifiedDiffString(
+		difflib.UnifiedDiff{
+			A:        difflib.SplitLines(before),
+			B:        difflib.SplitLines(after),
+			FromFile: path.Join("live", name),
+			ToFile:   path.Join("merged", name),
+			Context:  3,
+		},
+	)
+	if err != nil {
+		return ObjectDiff{}, fmt.Errorf("error generating diff: %w", err)
+	}
+
+	switch {
+	case live == nil:
+		result.Action = DiffCreated
+	case before == after:
+		result.Action = DiffUnchanged
+		return result, nil
+	default:
+		result.Action = DiffChanged
+	}
+
+	result.Diff = udiff
+	return result, nil
+}
+
+// live reads the live version of the provided object. The object is always read as
+// unstructured, returns nil if the object does not exist.
+func (r *Renderer) live(
+	ctx context.Context, obj client.Object,
+) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return nil, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gvk)
+	if err := r.cli.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading live object: %w", err)
+	}
+	return live, nil
+}
+
+// diffYAML returns the YAML representation of the provided object without the fields that are
+// not relevant when comparing objects (status, managed fields, resource version, etc).
+func diffYAML(gvk schema.GroupVersionKind, obj runtime.Object) (string, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", fmt.Errorf("error converting object to unstructured: %w", err)
+	}
+
+	// typed objects returned by the client may have lost their type
+	// information so we always set them here.
+	content["apiVersion"], content["kind"] = gvk.ToAPIVersionAndKind()
+	delete(content, "status")
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	unstructured.RemoveNestedField(content, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(content, "metadata", "generation")
+
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling object: %w", err)
+	}
+	return string(data), nil
+}
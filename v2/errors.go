@@ -0,0 +1,150 @@
+package plumber
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ErrRender is returned, wrapped, whenever an overlay can't be rendered. This includes errors
+// loading files, running mutators, running kustomize, converting the rendered objects and
+// parsing the plumber annotations present in them. Use errors.Is to check for it.
+var ErrRender = errors.New("error rendering overlay")
+
+// Phase is the step in which an operation on an object failed.
+type Phase string
+
+const (
+	// PhaseMutate is when the registered object mutators are executed.
+	PhaseMutate Phase = "mutate"
+	// PhaseRead is when the live object is read from the cluster.
+	PhaseRead Phase = "read"
+	// PhasePatch is when the object is patched (server side applied).
+	PhasePatch Phase = "patch"
+	// PhaseCreate is when the object is created.
+	PhaseCreate Phase = "create"
+	// PhasePostApply is when the registered post apply actions are executed.
+	PhasePostApply Phase = "post-apply"
+	// PhaseWait is when we wait for the object to reach a certain state.
+	PhaseWait Phase = "wait"
+	// PhaseDelete is when the object is deleted.
+	PhaseDelete Phase = "delete"
+	// PhasePrune is when the object is deleted as it is not part of the inventory anymore.
+	PhasePrune Phase = "prune"
+)
+
+// ObjectError is an error that happened while operating on a specific object. Use errors.As
+// to extract it from the errors returned by the Renderer.
+type ObjectError struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Phase     Phase
+	Err       error
+}
+
+// Error returns the error message, identifying the object and the failed phase.
+func (e *ObjectError) Error() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("%s failed for %s %s: %v", e.Phase, e.GVK.Kind, name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+// AggregateError holds all errors found during an Apply or a Delete when the Renderer has been
+// configured with WithContinueOnError. It is compatible with errors.Is and errors.As and, as
+// errors created through errors.Join, it implements Unwrap() []error.
+type AggregateError struct {
+	Errors []error
+}
+
+// Error returns all error messages, one per line.
+func (e *AggregateError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the aggregated errors, as errors created through errors.Join do.
+func (e *AggregateError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is returns true if any of the aggregated errors matches target. Go versions prior to 1.20 do
+// not walk errors returned by Unwrap() []error so we do it here.
+func (e *AggregateError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first aggregated error that matches target and, if found, sets target to it.
+// Go versions prior to 1.20 do not walk errors returned by Unwrap() []error so we do it here.
+func (e *AggregateError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten returns the errors aggregated by an AggregateError or the error itself otherwise.
+func flatten(err error) []error {
+	var agg *AggregateError
+	if errors.As(err, &agg) {
+		return agg.Errors
+	}
+	return []error{err}
+}
+
+// renderError wraps errors found while rendering an overlay, it matches ErrRender.
+type renderError struct {
+	err error
+}
+
+// Error returns the underlying error message.
+func (e *renderError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *renderError) Unwrap() error {
+	return e.err
+}
+
+// Is returns true if target is ErrRender.
+func (e *renderError) Is(target error) bool {
+	return target == ErrRender
+}
+
+// objectError returns an ObjectError for the provided object, phase and cause.
+func (r *Renderer) objectError(obj client.Object, phase Phase, err error) error {
+	gvk, gvkerr := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if gvkerr != nil {
+		gvk = obj.GetObjectKind().GroupVersionKind()
+	}
+
+	return &ObjectError{
+		GVK:       gvk,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Phase:     phase,
+		Err:       err,
+	}
+}
@@ -93,7 +93,7 @@ func main() {
 
 	renderer := plumber.NewRenderer(cli, resources, options...)
 	for _, overlay := range []string{"base", "scale-up", "scale-down"} {
-		if err := renderer.Apply(context.Background(), overlay); err != nil {
+		if _, err := renderer.Apply(context.Background(), overlay); err != nil {
 			panic(err)
 		}
 		fmt.Printf("overlay %q applied\n", overlay)
@@ -0,0 +1,148 @@
+package plumber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// IgnoreFieldsAnnotation is a comma separated list of fields the Renderer should not set once
+// they are managed by another field manager (e.g. "spec.replicas" when the replicas are managed
+// by a HorizontalPodAutoscaler). Fields are expressed as dot separated paths ("spec.replicas",
+// ".spec.replicas" or "{.spec.replicas}"), paths traversing lists are not supported.
+const IgnoreFieldsAnnotation = "plumber.io/ignore-fields"
+
+// fieldPath is a path to a field inside an object, e.g. ["spec", "replicas"].
+type fieldPath []string
+
+// String returns the path in its dot separated form.
+func (f fieldPath) String() string {
+	return "." + strings.Join(f, ".")
+}
+
+// parseFieldPath parses a dot separated path. Leading dots and JSONPath braces are ignored.
+func parseFieldPath(path string) (fieldPath, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+
+	parts := strings.Split(path, ".")
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, "[]*") {
+			return nil, fmt.Errorf("invalid field path %q", path)
+		}
+	}
+	return parts, nil
+}
+
+// ignoredFields returns, for each of the provided objects, the fields that must not be set if
+// owned by another field manager. Fields come from the IgnoreFieldsAnnotation and from the
+// fields registered through WithIgnoreFields. Objects without ignored fields are not present
+// in the returned map.
+func (r *Renderer) ignoredFields(objs []client.Object) (map[client.Object][]fieldPath, error) {
+	result := map[client.Object][]fieldPath{}
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return nil, fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		paths := append([]string{}, r.ignoreFields[gvk.GroupKind()]...)
+		if value := obj.GetAnnotations()[IgnoreFieldsAnnotation]; value != "" {
+			paths = append(paths, strings.Split(value, ",")...)
+		}
+
+		for _, path := range paths {
+			field, err := parseFieldPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing ignored field for %s: %w", obj.GetName(), err)
+			}
+			result[obj] = append(result[obj], field)
+		}
+	}
+	return result, nil
+}
+
+// releaseFields removes from the apply payload all the provided fields that are managed by a
+// field manager other than ours in the live object. Returns the payload as unstructured.
+func (r *Renderer) releaseFields(
+	ctx context.Context, obj, applied client.Object, fields []fieldPath,
+) (client.Object, error) {
+	live, err := r.live(ctx, obj)
+	if err != nil || live == nil {
+		return applied, err
+	}
+
+	var owned []fieldPath
+	for _, field := range fields {
+		foreign, err := r.foreignManaged(live, field)
+		if err != nil {
+			return nil, err
+		}
+
+		if foreign {
+			owned = append(owned, field)
+		}
+	}
+
+	if len(owned) == 0 {
+		return applied, nil
+	}
+
+	result, ok := applied.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(applied)
+		if err != nil {
+			return nil, fmt.Errorf("error converting object: %w", err)
+		}
+		result = &unstructured.Unstructured{Object: content}
+	}
+
+	for _, field := range owned {
+		unstructured.RemoveNestedField(result.Object, field...)
+	}
+	return result, nil
+}
+
+// foreignManaged returns true if the provided field is managed, in the live object, by a field
+// manager other than ours.
+func (r *Renderer) foreignManaged(live client.Object, field fieldPath) (bool, error) {
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager == r.fieldOwner || entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return false, fmt.Errorf("error parsing managed fields: %w", err)
+		}
+
+		if managesField(fields, field) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// managesField returns true if the provided field set (in the managed fields format, with keys
+// prefixed by "f:") includes the provided field or any of its children.
+func managesField(fields map[string]interface{}, field fieldPath) bool {
+	current := fields
+	for _, part := range field {
+		next, ok := current["f:"+part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		current = next
+	}
+	return true
+}
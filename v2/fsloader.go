@@ -1,27 +1,28 @@
 package plumber
 
 import (
-	"embed"
 	"fmt"
+	"io/fs"
 	"path"
 
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
-// LoadFS loads an embed FS struct into an in memory kustomize file system representation. Reads
-// all files from the embed and writes them to the FileSystem struct.
-func LoadFS(content embed.FS) (filesys.FileSystem, error) {
-	fs := filesys.MakeFsInMemory()
-	if err := readdir(".", content, fs); err != nil {
-		return nil, fmt.Errorf("error loading embed files: %w", err)
+// LoadFS loads a fs.FS into an in memory kustomize file system representation. Reads all files
+// from the provided fs.FS (an embed.FS, an os.DirFS, a fstest.MapFS, etc) and writes them to the
+// FileSystem struct.
+func LoadFS(content fs.FS) (filesys.FileSystem, error) {
+	virtfs := filesys.MakeFsInMemory()
+	if err := readdir(".", content, virtfs); err != nil {
+		return nil, fmt.Errorf("error loading files: %w", err)
 	}
-	return fs, nil
+	return virtfs, nil
 }
 
-// readdir reads a directory recursively from provided embed instance, copying everything into
-// a fs.FileSystem object. Any error aborts the process and 'to' is left in an unknown state.
-func readdir(dir string, from embed.FS, to filesys.FileSystem) error {
-	entries, err := from.ReadDir(dir)
+// readdir reads a directory recursively from provided fs.FS instance, copying everything into
+// a filesys.FileSystem object. Any error aborts the process and 'to' is left in an unknown state.
+func readdir(dir string, from fs.FS, to filesys.FileSystem) error {
+	entries, err := fs.ReadDir(from, dir)
 	if err != nil {
 		return fmt.Errorf("error reading dir: %w", err)
 	}
@@ -36,7 +37,7 @@ func readdir(dir string, from embed.FS, to filesys.FileSystem) error {
 			continue
 		}
 
-		fcontent, err := from.ReadFile(path)
+		fcontent, err := fs.ReadFile(from, path)
 		if err != nil {
 			return fmt.Errorf("error reading file: %w", err)
 		}
@@ -0,0 +1,36 @@
+package plumber
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HashAnnotation holds a hash of the desired state of an object. This annotation is added to
+// all objects when the Renderer is configured with WithSkipUnchanged.
+const HashAnnotation = "plumber.io/hash"
+
+// stamp computes a hash of the provided object and stores it in the HashAnnotation.
+func stamp(obj client.Object) error {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[HashAnnotation]; ok {
+		delete(annotations, HashAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("error marshaling object: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[HashAnnotation] = hex.EncodeToString(sum[:])
+	obj.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,84 @@
+package plumber
+
+import (
+	"fmt"
+	"io/fs"
+	"testing/fstest"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testFS returns an in memory filesystem with a base and an overlay named "overlay". The base
+// holds a Deployment and a Service, the overlay scales the Deployment up.
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"kustomize/base/kustomization.yaml": &fstest.MapFile{Data: []byte(`
+resources:
+- deployment.yaml
+- service.yaml
+`)},
+		"kustomize/base/deployment.yaml": &fstest.MapFile{Data: []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+  annotations:
+    owner: team
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: app:latest
+`)},
+		"kustomize/base/service.yaml": &fstest.MapFile{Data: []byte(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: default
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+`)},
+		"kustomize/overlay/kustomization.yaml": &fstest.MapFile{Data: []byte(`
+resources:
+- ../base
+replicas:
+- name: app
+  count: 3
+`)},
+	}
+}
+
+// testRenderer returns a Renderer reading from the provided filesystem. The Renderer client
+// only knows about the client-go scheme, no object exists in it.
+func testRenderer(from fs.FS, opts ...Option) *Renderer {
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	return NewRenderer(cli, from, opts...)
+}
+
+// manifestFS returns an in memory filesystem with an overlay named "test" holding the provided
+// manifests, one per file.
+func manifestFS(manifests ...string) fstest.MapFS {
+	files := fstest.MapFS{}
+	resources := "resources:\n"
+	for i, manifest := range manifests {
+		name := fmt.Sprintf("object-%d.yaml", i)
+		resources += fmt.Sprintf("- %s\n", name)
+		files["kustomize/test/"+name] = &fstest.MapFile{Data: []byte(manifest)}
+	}
+	files["kustomize/test/kustomization.yaml"] = &fstest.MapFile{Data: []byte(resources)}
+	return files
+}
@@ -0,0 +1,368 @@
+package plumber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// InventoryLabel is added to all objects applied by a Renderer configured with an inventory (see
+// WithInventory). The label value is the inventory name.
+const InventoryLabel = "plumber.io/inventory"
+
+// inventoryKey is the key, inside the inventory ConfigMap, where the list of objects is kept.
+const inventoryKey = "objects"
+
+// ObjectReference identifies an object kept in an inventory.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// String returns a human readable representation of the reference.
+func (o ObjectReference) String() string {
+	if o.Namespace == "" {
+		return fmt.Sprintf("%s/%s %s", o.APIVersion, o.Kind, o.Name)
+	}
+	return fmt.Sprintf("%s/%s %s/%s", o.APIVersion, o.Kind, o.Namespace, o.Name)
+}
+
+// key returns the key identifying the referenced object regardless of its API version. The same
+// object may be rendered, over time, using different versions of the same kind.
+func (o ObjectReference) key() referenceKey {
+	gv, _ := schema.ParseGroupVersion(o.APIVersion)
+	return referenceKey{
+		Group:     gv.Group,
+		Kind:      o.Kind,
+		Namespace: o.Namespace,
+		Name:      o.Name,
+	}
+}
+
+// referenceKey identifies an object kept in an inventory regardless of its API version.
+type referenceKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// inventory is a set of object references indexed by their version agnostic keys.
+type inventory map[referenceKey]ObjectReference
+
+// add adds the provided reference to the inventory, replacing any reference to the same object
+// using a different version.
+func (i inventory) add(ref ObjectReference) {
+	i[ref.key()] = ref
+}
+
+// has returns true if the inventory holds a reference to the same object, in any version.
+func (i inventory) has(ref ObjectReference) bool {
+	_, ok := i[ref.key()]
+	return ok
+}
+
+// refs returns the inventory content as a sorted slice.
+func (i inventory) refs() []ObjectReference {
+	refs := make([]ObjectReference, 0, len(i))
+	for _, ref := range i {
+		refs = append(refs, ref)
+	}
+
+	sort.Slice(refs, func(a, b int) bool {
+		return refs[a].String() < refs[b].String()
+	})
+	return refs
+}
+
+// reference returns an ObjectReference pointing to the provided object.
+func (r *Renderer) reference(obj client.Object) (ObjectReference, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return ObjectReference{}, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	return ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}, nil
+}
+
+// inventoryOf returns an inventory containing all the provided objects.
+func (r *Renderer) inventoryOf(objs []client.Object) (inventory, error) {
+	inv := inventory{}
+	for _, obj := range objs {
+		ref, err := r.reference(obj)
+		if err != nil {
+			return nil, err
+		}
+		inv.add(ref)
+	}
+	return inv, nil
+}
+
+// track labels the provided object as part of the inventory. This is a no-op if the Renderer
+// has not been configured with an inventory.
+func (r *Renderer) track(obj client.Object) {
+	if r.invName == "" {
+		return
+	}
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[InventoryLabel] = r.invName
+	obj.SetLabels(labels)
+}
+
+// readInventory reads the inventory ConfigMap from the cluster. Returns an empty inventory if
+// the ConfigMap does not exist yet.
+func (r *Renderer) readInventory(ctx context.Context) (inventory, error) {
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: r.invNamespace, Name: r.invName}
+	if err := r.cli.Get(ctx, key, cm); err != nil {
+		if errors.IsNotFound(err) {
+			return inventory{}, nil
+		}
+		return nil, fmt.Errorf("error reading inventory: %w", err)
+	}
+
+	var refs []ObjectReference
+	if data, ok := cm.Data[inventoryKey]; ok {
+		if err := json.Unmarshal([]byte(data), &refs); err != nil {
+			return nil, fmt.Errorf("error parsing inventory: %w", err)
+		}
+	}
+
+	inv := inventory{}
+	for _, ref := range refs {
+		inv.add(ref)
+	}
+	return inv, nil
+}
+
+// writeInventory stores the provided inventory in the cluster. If the inventory is empty the
+// ConfigMap is deleted instead.
+func (r *Renderer) writeInventory(ctx context.Context, inv inventory) error {
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: r.invNamespace,
+			Name:      r.invName,
+			Labels:    map[string]string{InventoryLabel: r.invName},
+		},
+	}
+
+	if len(inv) == 0 {
+		if err := r.retry(ctx, func() error {
+			return r.cli.Delete(ctx, cm)
+		}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting inventory: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(inv.refs())
+	if err != nil {
+		return fmt.Errorf("error marshaling inventory: %w", err)
+	}
+	cm.Data = map[string]string{inventoryKey: string(data)}
+
+	opts := []client.PatchOption{client.FieldOwner(r.fieldOwner), client.ForceOwnership}
+	err = r.retry(ctx, func() error {
+		return r.cli.Patch(ctx, cm, client.Apply, opts...)
+	})
+	if err == nil {
+		return nil
+	}
+
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("error writing inventory: %w", err)
+	}
+
+	// some api servers fail to apply objects that do not exist yet,
+	// see patch(), so we attempt to create the inventory instead.
+	if err := r.retry(ctx, func() error {
+		return r.cli.Create(ctx, cm, client.FieldOwner(r.fieldOwner))
+	}); err != nil {
+		return fmt.Errorf("error creating inventory: %w", err)
+	}
+	return nil
+}
+
+// recordInventory writes the provided inventory before any object is applied. If the inventory
+// namespace does not exist yet but is part of the overlay the write is postponed until the
+// namespace has been applied, see flushInventory.
+func (r *Renderer) recordInventory(
+	ctx context.Context, op *operation, objs []client.Object, inv inventory,
+) error {
+	err := r.writeInventory(ctx, inv)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	// we can only postpone the write if the namespace is missing,
+	// any other not found error is returned as is.
+	ns := &corev1.Namespace{}
+	nserr := r.cli.Get(ctx, client.ObjectKey{Name: r.invNamespace}, ns)
+	if nserr == nil {
+		return err
+	}
+
+	if !errors.IsNotFound(nserr) {
+		return fmt.Errorf("error reading inventory namespace: %w", nserr)
+	}
+
+	for _, obj := range objs {
+		gvk, gvkerr := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if gvkerr != nil {
+			return fmt.Errorf("error finding object kind: %w", gvkerr)
+		}
+
+		if gvk.Group == "" && gvk.Kind == "Namespace" && obj.GetName() == r.invNamespace {
+			op.pending = inv
+			op.pendingAfter = obj
+			return nil
+		}
+	}
+	return fmt.Errorf("inventory namespace %s does not exist: %w", r.invNamespace, err)
+}
+
+// flushInventory writes the postponed inventory (see recordInventory) if the inventory
+// namespace is among the provided objects and has been successfully applied.
+func (r *Renderer) flushInventory(ctx context.Context, op *operation, objs []client.Object) error {
+	if op.pending == nil || op.failed[op.pendingAfter] {
+		return nil
+	}
+
+	for _, obj := range objs {
+		if obj != op.pendingAfter {
+			continue
+		}
+
+		if err := r.writeInventory(ctx, op.pending); err != nil {
+			return err
+		}
+		op.pending = nil
+		return nil
+	}
+	return nil
+}
+
+// pruneInventory deletes all objects present in the previous inventory but absent in the
+// current one. Objects are only deleted if they still carry the inventory label and if no other
+// field manager has applied them, objects adopted by someone else are left untouched and removed
+// from the inventory. Pruned objects are recorded in the operation result.
+func (r *Renderer) pruneInventory(
+	ctx context.Context, op *operation, previous, current inventory,
+) error {
+	opts := r.deleteOptions(op.dryRun)
+
+	// we prune in the reverse order objects are applied so custom
+	// resources go away before their definitions and so on.
+	refs := previous.refs()
+	sort.SliceStable(refs, func(a, b int) bool {
+		return stageOf(refs[a].Kind) > stageOf(refs[b].Kind)
+	})
+
+	for _, ref := range refs {
+		if current.has(ref) {
+			continue
+		}
+
+		start := time.Now()
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+		key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+		if err := r.cli.Get(ctx, key, obj); err != nil {
+			// if the kind is not served anymore (e.g. its crd has
+			// been removed) the object is gone as well.
+			if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return r.objectError(obj, PhaseRead, err)
+		}
+
+		res := ObjectResult{
+			GVK:       obj.GroupVersionKind(),
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+			Action:    ActionPruned,
+			Object:    obj,
+		}
+
+		if !r.prunable(obj) {
+			res.Action = ActionSkipped
+			res.Message = "object not exclusively managed by us, not pruned"
+			op.result.Objects = append(op.result.Objects, res)
+			continue
+		}
+
+		keep, err := r.kept(obj)
+		if err != nil {
+			return r.objectError(obj, PhasePrune, err)
+		}
+
+		if keep {
+			res.Action = ActionSkipped
+			res.Message = "object protected by on-delete policy, not pruned"
+			op.result.Objects = append(op.result.Objects, res)
+			continue
+		}
+
+		err = r.retry(ctx, func() error {
+			return r.cli.Delete(ctx, obj, opts...)
+		})
+		res.Duration = time.Since(start)
+		if err != nil && !errors.IsNotFound(err) {
+			res.Action = ActionFailed
+			res.Err = r.objectError(obj, PhasePrune, err)
+			op.result.Objects = append(op.result.Objects, res)
+			return res.Err
+		}
+		op.result.Objects = append(op.result.Objects, res)
+	}
+	return nil
+}
+
+// prunable returns true if the provided live object can be safely pruned. Objects must carry
+// our inventory label and must have been applied by our field owner only. Managers using
+// Update operations (controllers writing status, for example) are not taken into account.
+func (r *Renderer) prunable(obj client.Object) bool {
+	if obj.GetLabels()[InventoryLabel] != r.invName {
+		return false
+	}
+
+	var owned bool
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == r.fieldOwner {
+			owned = true
+			continue
+		}
+
+		if entry.Operation == metav1.ManagedFieldsOperationApply {
+			return false
+		}
+	}
+	return owned
+}
@@ -0,0 +1,31 @@
+package plumber
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// OnDeleteAnnotation determines what happens to an object when the Renderer deletes or prunes
+// it. Set it to OnDeleteKeep for the object to be left in the cluster. Unlike the other plumber
+// annotations this one is sent to the API server so it can be read back from live objects when
+// they are pruned.
+const OnDeleteAnnotation = "plumber.io/on-delete"
+
+// OnDeleteKeep is the OnDeleteAnnotation value that protects an object from deletion.
+const OnDeleteKeep = "keep"
+
+// kept returns true if the provided object must not be deleted, either because it has been
+// annotated to be kept or because its kind has been registered through WithKeepOnDelete.
+func (r *Renderer) kept(obj client.Object) (bool, error) {
+	if obj.GetAnnotations()[OnDeleteAnnotation] == OnDeleteKeep {
+		return true, nil
+	}
+
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return false, fmt.Errorf("error finding object kind: %w", err)
+	}
+	return r.keepKinds[gvk.GroupKind()], nil
+}
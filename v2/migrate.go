@@ -0,0 +1,55 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultLegacyManagers are the field managers whose fields are migrated when the Renderer is
+// configured with WithManagedFieldsMigration without specifying any manager. These are the
+// managers used by kubectl when it is not using server side apply.
+var DefaultLegacyManagers = []string{
+	"kubectl-client-side-apply",
+	"kubectl-create",
+	"kubectl-edit",
+	"kubectl-replace",
+	"kubectl",
+}
+
+// migrateManagedFields moves the ownership of all fields managed through Update operations by
+// any of the legacy field managers to our field owner. The provided live metadata is updated
+// with the metadata returned by the API server. This is a no-op if there is nothing to migrate.
+func (r *Renderer) migrateManagedFields(
+	ctx context.Context, obj client.Object, live *metav1.PartialObjectMetadata,
+) error {
+	managers := sets.New(r.legacyManagers...)
+	first := true
+	return r.retry(ctx, func() error {
+		// the patch includes the resource version so we have to
+		// read the object again if a previous attempt has failed.
+		if !first {
+			current, err := r.metadata(ctx, obj)
+			if err != nil || current == nil {
+				return err
+			}
+			current.DeepCopyInto(live)
+		}
+		first = false
+
+		patch, err := csaupgrade.UpgradeManagedFieldsPatch(live, managers, r.fieldOwner)
+		if err != nil {
+			return fmt.Errorf("error migrating managed fields: %w", err)
+		}
+
+		if patch == nil {
+			return nil
+		}
+		return r.cli.Patch(ctx, live, client.RawPatch(types.JSONPatchType, patch))
+	})
+}
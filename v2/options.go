@@ -1,5 +1,12 @@
 package plumber
 
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
 // Option is a function that sets an option in a Renderer.
 type Option func(*Renderer)
 
@@ -18,6 +25,217 @@ func WithForceOwnership() Option {
 	}
 }
 
+// WithDryRun makes Apply and Delete send all requests using server side dry-run. Objects are
+// validated by the API server (admission webhooks, schema validation, quota) but no change is
+// persisted in the cluster. Post apply actions are not executed in this mode.
+func WithDryRun() Option {
+	return func(r *Renderer) {
+		r.dryRun = true
+	}
+}
+
+// WithInventory makes the Renderer keep track of the objects it applies. All applied objects
+// are labeled with InventoryLabel and a list of references to them is stored in a ConfigMap
+// with the provided namespace and name. The inventory is required for pruning, see WithPrune.
+func WithInventory(namespace, name string) Option {
+	return func(r *Renderer) {
+		r.invNamespace = namespace
+		r.invName = name
+	}
+}
+
+// WithPrune makes Apply delete objects that were part of the previous inventory but are not
+// part of the overlay being applied (a manifest removed from the base or a different overlay
+// being applied). Only objects exclusively applied by the Renderer field owner are deleted.
+// This option has no effect unless an inventory is configured through WithInventory.
+func WithPrune() Option {
+	return func(r *Renderer) {
+		r.prune = true
+	}
+}
+
+// WithWaitForReady makes Apply wait for all applied objects to become ready before returning.
+// Readiness is assessed generically for the most common kinds (Deployments, StatefulSets, Jobs,
+// etc) and through the Ready condition for any other kind. The timeout is also used when
+// waiting for objects in a wave to become ready before applying the next one. If the timeout is
+// zero DefaultReadyTimeout is used.
+func WithWaitForReady(timeout time.Duration) Option {
+	return func(r *Renderer) {
+		if timeout == 0 {
+			timeout = DefaultReadyTimeout
+		}
+		r.waitReady = true
+		r.readyTimeout = timeout
+	}
+}
+
+// WithRollback makes Apply roll back its changes when it fails. The live version of each object
+// is saved before the object is applied, on failure the saved versions are restored and the
+// objects created by Apply are deleted, in the reverse order they were applied. Objects pruned
+// from the inventory are not restored.
+func WithRollback() Option {
+	return func(r *Renderer) {
+		r.rollback = true
+	}
+}
+
+// WithContinueOnError makes Apply and Delete attempt every object instead of returning at the
+// first failure. All errors are collected and returned as an AggregateError once all objects
+// have been processed. Post apply actions are still executed for objects applied successfully.
+func WithContinueOnError() Option {
+	return func(r *Renderer) {
+		r.continueOnError = true
+	}
+}
+
+// WithRetry makes the Renderer retry failed Patch, Create and Delete calls according to the
+// provided policy. See DefaultRetryPolicy for a sensible default.
+func WithRetry(policy RetryPolicy) Option {
+	return func(r *Renderer) {
+		r.retryPolicy = &policy
+	}
+}
+
+// WithConcurrency makes Apply apply up to 'workers' objects concurrently. Only objects that do
+// not depend on each other are applied concurrently: ordering between stages (CRDs and
+// Namespaces first, etc) and between waves is always respected. Post apply actions are never
+// called concurrently and the returned result lists objects in a deterministic order.
+func WithConcurrency(workers int) Option {
+	return func(r *Renderer) {
+		r.concurrency = workers
+	}
+}
+
+// WithSkipUnchanged makes Apply skip objects that have not changed since they were last applied.
+// A hash of each object desired state is stored in the HashAnnotation and compared with the one
+// present in the live object, read through a metadata only Get (served from the cache if the
+// client is a cached one). If they match no patch is sent. Changes made to the live object by
+// third parties are not reverted while the desired state does not change.
+func WithSkipUnchanged() Option {
+	return func(r *Renderer) {
+		r.skipUnchanged = true
+	}
+}
+
+// WithStaticFS makes the Renderer read the fs.FS only once, the first time it is needed, and
+// work with copies of it afterwards. This is always the case for an embed.FS or an *embed.FS,
+// this option extends it to other implementations whose content never changes (e.g. the result
+// of fs.Sub on an embed.FS). FS mutators still run on every call, on a fresh copy.
+func WithStaticFS() Option {
+	return func(r *Renderer) {
+		r.staticFS = true
+	}
+}
+
+// WithConflictPolicy sets a policy to decide, per object, what to do when an object can't be
+// applied because some of its fields are owned by other field managers: force the ownership,
+// skip the object or fail. Without a policy (and without WithForceOwnership) conflicts fail
+// with a ConflictError.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(r *Renderer) {
+		r.conflictPolicy = policy
+	}
+}
+
+// WithManagedFieldsMigration makes the Renderer, before applying an object, move the ownership
+// of the fields managed by the provided legacy field managers to its own field owner. This is
+// useful for objects originally created by kubectl apply (client side) or by Update calls, as
+// otherwise fields removed from the overlays are never removed from the live objects. If no
+// manager is provided DefaultLegacyManagers is used. Migrations are skipped in dry-run mode.
+func WithManagedFieldsMigration(managers ...string) Option {
+	return func(r *Renderer) {
+		if len(managers) == 0 {
+			managers = DefaultLegacyManagers
+		}
+		r.legacyManagers = append(r.legacyManagers, managers...)
+	}
+}
+
+// WithRecreateOnImmutable makes the Renderer delete (with foreground propagation) and create
+// again objects of the provided kinds when they can't be applied because an immutable field
+// has changed (e.g. a Job pod template or a Deployment selector). StatefulSets whose volume
+// claim templates have changed are deleted orphaning their pods and claims so these survive
+// the recreation. This can also be enabled per object through RecreateAnnotation.
+func WithRecreateOnImmutable(gks ...schema.GroupKind) Option {
+	return func(r *Renderer) {
+		if r.recreateKinds == nil {
+			r.recreateKinds = map[schema.GroupKind]bool{}
+		}
+		for _, gk := range gks {
+			r.recreateKinds[gk] = true
+		}
+	}
+}
+
+// WithClaimExpansion makes the Renderer, after recreating a StatefulSet whose volume claim
+// templates have changed (see WithRecreateOnImmutable), expand the existing claims to match
+// the storage requested in the templates. Claims are only expanded if their storage class
+// allows volume expansion.
+func WithClaimExpansion() Option {
+	return func(r *Renderer) {
+		r.claimExpansion = true
+	}
+}
+
+// WithDeletePropagation sets the propagation policy used when deleting and pruning objects
+// (foreground, background or orphan). By default the policy of each kind is used.
+func WithDeletePropagation(policy metav1.DeletionPropagation) Option {
+	return func(r *Renderer) {
+		r.propagation = &policy
+	}
+}
+
+// WithWaitForDeletion makes Delete wait, after deleting each object, until the object is gone.
+// Objects still present after the timeout (DefaultDeletionTimeout if zero) make Delete fail
+// with a PendingDeletionError listing the finalizers still pending. Waits are skipped in
+// dry-run mode.
+func WithWaitForDeletion(timeout time.Duration) Option {
+	return func(r *Renderer) {
+		if timeout == 0 {
+			timeout = DefaultDeletionTimeout
+		}
+		r.waitDeleted = true
+		r.deleteTimeout = timeout
+	}
+}
+
+// WithFinalizerRemoval makes Delete remove the finalizers of the objects still present after
+// the WithWaitForDeletion timeout. This is an escape hatch for objects held by finalizers
+// whose controllers are gone, use with care as it skips whatever cleanup the finalizers were
+// meant to do. It has no effect unless WithWaitForDeletion is also used.
+func WithFinalizerRemoval() Option {
+	return func(r *Renderer) {
+		r.dropFinalizers = true
+	}
+}
+
+// WithKeepOnDelete protects all objects of the provided kinds (e.g. CustomResourceDefinitions
+// or PersistentVolumeClaims) from being deleted by Delete or pruned. Protected objects are
+// reported as skipped. Individual objects can be protected through OnDeleteAnnotation.
+func WithKeepOnDelete(gks ...schema.GroupKind) Option {
+	return func(r *Renderer) {
+		if r.keepKinds == nil {
+			r.keepKinds = map[schema.GroupKind]bool{}
+		}
+		for _, gk := range gks {
+			r.keepKinds[gk] = true
+		}
+	}
+}
+
+// WithIgnoreFields makes the Renderer stop setting the provided fields, for all objects of the
+// provided GroupKind, once they are managed by another field manager. This is useful to avoid
+// fights with controllers such as the HorizontalPodAutoscaler. Fields are expressed as dot
+// separated paths, e.g. "spec.replicas". See also IgnoreFieldsAnnotation.
+func WithIgnoreFields(gk schema.GroupKind, paths ...string) Option {
+	return func(r *Renderer) {
+		if r.ignoreFields == nil {
+			r.ignoreFields = map[schema.GroupKind][]string{}
+		}
+		r.ignoreFields[gk] = append(r.ignoreFields[gk], paths...)
+	}
+}
+
 // WithKustomizeMutator register a Kustomization mutator into the controller.
 func WithKustomizeMutator(mutator KustomizeMutator) Option {
 	return func(r *Renderer) {
@@ -0,0 +1,189 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// CRDEstablishTimeout is how long we wait for applied CustomResourceDefinitions to become
+// Established before moving on and applying the remaining objects.
+const CRDEstablishTimeout = time.Minute
+
+// stage is a group of kinds applied together. Stages are applied in order, all objects in one
+// stage are applied before any object in the next one.
+type stage int
+
+const (
+	// stageDefinitions holds objects other objects live in or are instances of.
+	stageDefinitions stage = iota
+	// stageCluster holds cluster and namespace wide policies.
+	stageCluster
+	// stageRBAC holds service accounts, roles and their bindings.
+	stageRBAC
+	// stageConfig holds configuration and storage objects consumed by workloads.
+	stageConfig
+	// stageWorkloads holds services and workloads.
+	stageWorkloads
+	// stageCustom holds custom resources and objects that depend on workloads being in
+	// place (webhook configurations and api services). Unknown kinds end up here.
+	stageCustom
+)
+
+// kindStages maps known kinds into their stages.
+var kindStages = map[string]stage{
+	"Namespace":                      stageDefinitions,
+	"CustomResourceDefinition":       stageDefinitions,
+	"PriorityClass":                  stageCluster,
+	"StorageClass":                   stageCluster,
+	"IngressClass":                   stageCluster,
+	"RuntimeClass":                   stageCluster,
+	"ResourceQuota":                  stageCluster,
+	"LimitRange":                     stageCluster,
+	"PodSecurityPolicy":              stageCluster,
+	"NetworkPolicy":                  stageCluster,
+	"PodDisruptionBudget":            stageCluster,
+	"ServiceAccount":                 stageRBAC,
+	"ClusterRole":                    stageRBAC,
+	"ClusterRoleBinding":             stageRBAC,
+	"Role":                           stageRBAC,
+	"RoleBinding":                    stageRBAC,
+	"Secret":                         stageConfig,
+	"ConfigMap":                      stageConfig,
+	"PersistentVolume":               stageConfig,
+	"PersistentVolumeClaim":          stageConfig,
+	"Service":                        stageWorkloads,
+	"Endpoints":                      stageWorkloads,
+	"Pod":                            stageWorkloads,
+	"ReplicationController":          stageWorkloads,
+	"ReplicaSet":                     stageWorkloads,
+	"Deployment":                     stageWorkloads,
+	"DaemonSet":                      stageWorkloads,
+	"StatefulSet":                    stageWorkloads,
+	"Job":                            stageWorkloads,
+	"CronJob":                        stageWorkloads,
+	"HorizontalPodAutoscaler":        stageWorkloads,
+	"Ingress":                        stageWorkloads,
+	"APIService":                     stageCustom,
+	"MutatingWebhookConfiguration":   stageCustom,
+	"ValidatingWebhookConfiguration": stageCustom,
+}
+
+// stageOf returns the stage for the provided kind.
+func stageOf(kind string) stage {
+	if p, ok := kindStages[kind]; ok {
+		return p
+	}
+	return stageCustom
+}
+
+// stages splits the provided objects into groups according to their kinds. Groups are returned
+// in the order they must be applied, objects inside each group keep the order in which they
+// were rendered. Empty groups are not returned.
+func (r *Renderer) stages(objs []client.Object) ([][]client.Object, error) {
+	groups := make([][]client.Object, stageCustom+1)
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return nil, fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		p := stageOf(gvk.Kind)
+		groups[p] = append(groups[p], obj)
+	}
+
+	var result [][]client.Object
+	for _, group := range groups {
+		if len(group) > 0 {
+			result = append(result, group)
+		}
+	}
+	return result, nil
+}
+
+// reversed returns the provided stages in the order objects must be deleted, i.e. the apply
+// order reversed, including the order of the objects inside each stage.
+func reversed(stages [][]client.Object) [][]client.Object {
+	result := make([][]client.Object, 0, len(stages))
+	for i := len(stages) - 1; i >= 0; i-- {
+		group := make([]client.Object, 0, len(stages[i]))
+		for j := len(stages[i]) - 1; j >= 0; j-- {
+			group = append(group, stages[i][j])
+		}
+		result = append(result, group)
+	}
+	return result
+}
+
+// awaitCRDs waits for all CustomResourceDefinitions among the provided objects to become
+// Established. Once they are all established the client RESTMapper is reset so the new
+// kinds can be mapped.
+func (r *Renderer) awaitCRDs(ctx context.Context, objs []client.Object) error {
+	var found bool
+	var errs []error
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		if gvk.Kind != "CustomResourceDefinition" {
+			continue
+		}
+
+		found = true
+		crd := &unstructured.Unstructured{}
+		crd.SetGroupVersionKind(gvk)
+		key := client.ObjectKeyFromObject(obj)
+		if err := wait.PollImmediateWithContext(
+			ctx, time.Second, CRDEstablishTimeout,
+			func(ctx context.Context) (bool, error) {
+				if err := r.cli.Get(ctx, key, crd); err != nil {
+					return false, err
+				}
+				return hasCondition(crd, "Established", "True"), nil
+			},
+		); err != nil {
+			err = fmt.Errorf("error waiting for crd to be established: %w", err)
+			err = r.objectError(obj, PhaseWait, err)
+			if !r.continueOnError {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	if found {
+		if mapper, ok := r.cli.RESTMapper().(meta.ResettableRESTMapper); ok {
+			mapper.Reset()
+		}
+	}
+
+	if len(errs) > 0 {
+		return &AggregateError{Errors: errs}
+	}
+	return nil
+}
+
+// hasCondition returns true if the provided object has, in its status, a condition of the
+// given type with the given status.
+func hasCondition(obj *unstructured.Unstructured, ctype, status string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, raw := range conditions {
+		cond, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if cond["type"] == ctype && cond["status"] == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package plumber
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the encoding used when writing rendered objects into an io.Writer.
+type Format string
+
+const (
+	// FormatYAML writes objects as a multi document YAML stream.
+	FormatYAML Format = "yaml"
+	// FormatJSON writes objects as a JSON encoded v1 List.
+	FormatJSON Format = "json"
+)
+
+// RenderTo renders the provided overlay and writes the resulting objects into 'w' using the
+// provided format. Objects are written as rendered by kustomize with the changes made by the
+// mutators applied on top, zero valued fields of typed objects (creationTimestamp, status and
+// so on) are not written. The output can be applied as is (e.g. committed to a GitOps repo).
+func (r *Renderer) RenderTo(ctx context.Context, overlay string, w io.Writer, format Format) error {
+	objs, sources, err := r.render(ctx, overlay)
+	if err != nil {
+		return err
+	}
+
+	out := make([]client.Object, 0, len(objs))
+	for _, obj := range objs {
+		clean, err := payload(obj, sources[obj])
+		if err != nil {
+			return r.objectError(obj, PhaseMutate, err)
+		}
+		out = append(out, clean)
+	}
+	return WriteObjects(w, out, format)
+}
+
+// WriteObjects encodes the provided objects into 'w'. With FormatYAML objects are written as
+// YAML documents separated by '---', with FormatJSON a single v1 List holding all the objects
+// is written instead. Objects are written as they are, typed objects include their zero valued
+// fields, see RenderTo.
+func WriteObjects(w io.Writer, objs []client.Object, format Format) error {
+	switch format {
+	case FormatYAML:
+		return writeYAML(w, objs)
+	case FormatJSON:
+		return writeJSON(w, objs)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+// writeYAML writes all objects as a multi document YAML stream.
+func writeYAML(w io.Writer, objs []client.Object) error {
+	for i, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("error marshaling object to yaml: %w", err)
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return fmt.Errorf("error writing separator: %w", err)
+			}
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("error writing object: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeJSON writes all objects wrapped in a v1 List, the same way kubectl does when more than
+// one object is printed as JSON.
+func writeJSON(w io.Writer, objs []client.Object) error {
+	list := struct {
+		APIVersion string          `json:"apiVersion"`
+		Kind       string          `json:"kind"`
+		Items      []client.Object `json:"items"`
+	}{
+		APIVersion: "v1",
+		Kind:       "List",
+		Items:      objs,
+	}
+	if list.Items == nil {
+		list.Items = []client.Object{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(list); err != nil {
+		return fmt.Errorf("error encoding objects to json: %w", err)
+	}
+	return nil
+}
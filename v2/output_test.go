@@ -0,0 +1,68 @@
+package plumber
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRenderTo(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format Format
+		decode func([]byte) error
+	}{
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			decode: func(data []byte) error {
+				for _, doc := range strings.Split(string(data), "---\n") {
+					var obj map[string]interface{}
+					if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			decode: func(data []byte) error {
+				var list map[string]interface{}
+				return json.Unmarshal(data, &list)
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			renderer := testRenderer(testFS())
+			if err := renderer.RenderTo(context.Background(), "overlay", buf, tt.format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := tt.decode(buf.Bytes()); err != nil {
+				t.Fatalf("unable to decode output: %v", err)
+			}
+
+			output := buf.String()
+			for _, unexpected := range []string{
+				"creationTimestamp", "status", "strategy", "resources", "targetPort",
+			} {
+				if strings.Contains(output, unexpected) {
+					t.Errorf("unexpected %q found in output:\n%s", unexpected, output)
+				}
+			}
+
+			for _, expected := range []string{"Deployment", "Service", "app:latest"} {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected %q not found in output:\n%s", expected, output)
+				}
+			}
+		})
+	}
+}
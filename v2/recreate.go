@@ -0,0 +1,177 @@
+package plumber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// RecreateAnnotation, when set to "true", makes the Renderer delete and create again the object
+// if it can't be applied because an immutable field has changed. See WithRecreateOnImmutable.
+const RecreateAnnotation = "plumber.io/recreate-on-immutable"
+
+// RecreateTimeout is how long we wait for an object to be gone before creating it again.
+const RecreateTimeout = 2 * time.Minute
+
+// RecreateError is returned when an object has been deleted in order to be recreated but it
+// could not be created again. The object no longer exists in the cluster. Use errors.As to
+// extract it from the errors returned by the Renderer.
+type RecreateError struct {
+	Err error
+}
+
+// Error returns the error message.
+func (e *RecreateError) Error() string {
+	return fmt.Sprintf("object deleted but not created again: %v", e.Err)
+}
+
+// Unwrap returns the error returned when creating the object.
+func (e *RecreateError) Unwrap() error {
+	return e.Err
+}
+
+// lost returns true if the error says an object has been deleted but not created again.
+func lost(err error) bool {
+	var rerr *RecreateError
+	return errors.As(err, &rerr)
+}
+
+// recreatable returns the objects that must be recreated if any of their immutable fields has
+// changed. These are the objects annotated with RecreateAnnotation and the objects of any of
+// the kinds registered through WithRecreateOnImmutable.
+func (r *Renderer) recreatable(objs []client.Object) (map[client.Object]bool, error) {
+	result := map[client.Object]bool{}
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return nil, fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		recreate := r.recreateKinds[gvk.GroupKind()]
+		if value, ok := obj.GetAnnotations()[RecreateAnnotation]; ok {
+			if recreate, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf(
+					"invalid %s annotation on %s: %w", RecreateAnnotation, obj.GetName(), err,
+				)
+			}
+		}
+
+		if recreate {
+			result[obj] = true
+		}
+	}
+	return result, nil
+}
+
+// immutable returns true if the error has been caused by an attempt to change an immutable
+// field.
+func immutable(err error) bool {
+	return apierrors.IsInvalid(err) && strings.Contains(err.Error(), "field is immutable")
+}
+
+// recreate deletes the provided object using the provided propagation policy, waits until it
+// is gone and applies it again. In dry-run mode the deletion is only simulated and the object
+// is not applied again (it still exists). If the object can't be applied again a RecreateError
+// is returned.
+func (r *Renderer) recreate(
+	ctx context.Context, op *operation, obj client.Object, policy metav1.DeletionPropagation,
+) error {
+	opts := []client.DeleteOption{client.PropagationPolicy(policy)}
+	if op.dryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+
+	if err := r.retry(ctx, func() error {
+		return r.cli.Delete(ctx, obj, opts...)
+	}); err != nil && !apierrors.IsNotFound(err) {
+		return r.objectError(obj, PhaseDelete, err)
+	}
+
+	if op.dryRun {
+		return nil
+	}
+
+	if err := r.awaitGone(ctx, obj, RecreateTimeout); err != nil {
+		return r.objectError(obj, PhaseWait, err)
+	}
+
+	if err := r.patch(ctx, op, obj); err != nil {
+		return &RecreateError{Err: err}
+	}
+	return nil
+}
+
+// recoverPatch attempts to recover from a failed patch by recreating the object. This happens
+// when an immutable field has changed in an object configured to be recreated, in which case
+// the object is deleted using foreground propagation, or when the volume claim templates of a
+// StatefulSet configured to be recreated have changed, in which case the StatefulSet is deleted
+// orphaning its pods and claims. Returns a message describing what has been done or the
+// original error if there is no way to recover.
+func (r *Renderer) recoverPatch(
+	ctx context.Context, op *operation, obj client.Object, perr error,
+) (string, error) {
+	if !op.recreate[obj] {
+		return "", perr
+	}
+
+	if immutable(perr) {
+		if err := r.recreate(ctx, op, obj, metav1.DeletePropagationForeground); err != nil {
+			return "", err
+		}
+		return "immutable fields changed, object recreated", nil
+	}
+
+	changed, err := r.claimTemplatesChanged(ctx, obj, perr)
+	if err != nil {
+		return "", r.objectError(obj, PhaseRead, err)
+	}
+
+	if !changed {
+		return "", perr
+	}
+
+	if err := r.recreate(ctx, op, obj, metav1.DeletePropagationOrphan); err != nil {
+		return "", err
+	}
+
+	msg := "volume claim templates changed, object recreated orphaning its pods and claims"
+	if !r.claimExpansion || op.dryRun {
+		return msg, nil
+	}
+
+	expanded, refused, err := r.expandClaims(ctx, obj)
+	if err != nil {
+		return "", r.objectError(obj, PhasePostApply, err)
+	}
+
+	if len(expanded) > 0 {
+		msg = fmt.Sprintf("%s, claims expanded: %s", msg, strings.Join(expanded, ", "))
+	}
+	if len(refused) > 0 {
+		msg = fmt.Sprintf("%s, claims not expandable: %s", msg, strings.Join(refused, ", "))
+	}
+	return msg, nil
+}
+
+// awaitGone waits until the provided object does not exist anymore or the timeout is reached.
+func (r *Renderer) awaitGone(ctx context.Context, obj client.Object, timeout time.Duration) error {
+	if err := wait.PollImmediateWithContext(
+		ctx, time.Second, timeout,
+		func(ctx context.Context) (bool, error) {
+			meta, err := r.metadata(ctx, obj)
+			return meta == nil, err
+		},
+	); err != nil {
+		return fmt.Errorf("error waiting for object to be deleted: %w", err)
+	}
+	return nil
+}
@@ -2,17 +2,19 @@ package plumber
 
 import (
 	"context"
-	"embed"
 	"encoding/json"
 	"fmt"
-	"path"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8syaml "k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/resource"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
@@ -21,7 +23,7 @@ import (
 )
 
 // BaseKustomizationPath is the location for the base kustomization.yaml file. This controller
-// expects to find this file among the read files from the embed reference. This is the file
+// expects to find this file among the read files from the fs.FS reference. This is the file
 // that, after parse, is send over to all registered KMutators for further transformations.
 const BaseKustomizationPath = "/kustomize/base/kustomization.yaml"
 
@@ -36,14 +38,14 @@ type ObjectMutator func(context.Context, client.Object) error
 // objects resumes once these functions returns no error.
 type PostApplyAction func(context.Context, client.Object) error
 
-// FSMutator is a function that is intended to mutate a embed files prior to rendering them as
+// FSMutator is a function that is intended to mutate the loaded files prior to rendering them as
 // a kustomize graph.
 type FSMutator func(context.Context, filesys.FileSystem) error
 
 // Renderer is a base controller to provide some tooling around rendering and creating resources
 // based in a kustomize directory struct. Files are expected to be injected into this controller
-// by means of an embed.FS struct. The filesystem struct, inside the embed.FS struct, is expected
-// to comply with the following layout:
+// by means of a fs.FS (usually an embed.FS struct or a directory on disk). The filesystem struct,
+// inside the fs.FS, is expected to comply with the following layout:
 //
 // /kustomize
 // /kustomize/base/kustomization.yaml
@@ -57,25 +59,53 @@ type FSMutator func(context.Context, filesys.FileSystem) error
 // In other words, we have a base kustomization under base/ directory and each other directory is
 // treated as an overlay to be applied on top of base.
 type Renderer struct {
-	cli          client.Client
-	from         embed.FS
-	fieldOwner   string
-	forceOwner   bool
-	unstructured bool
-	kmutators    []KustomizeMutator
-	omutators    []ObjectMutator
-	postApply    []PostApplyAction
-	fsmutators   []FSMutator
+	cli             client.Client
+	from            fs.FS
+	fieldOwner      string
+	forceOwner      bool
+	conflictPolicy  ConflictPolicy
+	legacyManagers  []string
+	recreateKinds   map[schema.GroupKind]bool
+	claimExpansion  bool
+	propagation     *metav1.DeletionPropagation
+	waitDeleted     bool
+	deleteTimeout   time.Duration
+	dropFinalizers  bool
+	keepKinds       map[schema.GroupKind]bool
+	dryRun          bool
+	prune           bool
+	rollback        bool
+	continueOnError bool
+	retryPolicy     *RetryPolicy
+	concurrency     int
+	skipUnchanged   bool
+	staticFS        bool
+	loadOnce        sync.Once
+	loaded          filesys.FileSystem
+	loadErr         error
+	cacheMtx        sync.Mutex
+	builds          map[string]build
+	ignoreFields    map[schema.GroupKind][]string
+	invNamespace    string
+	invName         string
+	waitReady       bool
+	readyTimeout    time.Duration
+	unstructured    bool
+	kmutators       []KustomizeMutator
+	omutators       []ObjectMutator
+	postApply       []PostApplyAction
+	fsmutators      []FSMutator
 }
 
-// NewRenderer returns a kustomize renderer reading and applying files provided by the embed.FS
-// reference. Files are read from 'emb' into a filesys.FileSystem representation and then used
-// as argument to Kustomize when generating objects.
-func NewRenderer(cli client.Client, emb embed.FS, opts ...Option) *Renderer {
+// NewRenderer returns a kustomize renderer reading and applying files provided by the fs.FS
+// reference. Files are read from 'from' into a filesys.FileSystem representation and then used
+// as argument to Kustomize when generating objects. An embed.FS can be provided here as is.
+func NewRenderer(cli client.Client, from fs.FS, opts ...Option) *Renderer {
 	ctrl := &Renderer{
-		cli:        cli,
-		from:       emb,
-		fieldOwner: "plumber",
+		cli:          cli,
+		from:         from,
+		fieldOwner:   "plumber",
+		readyTimeout: DefaultReadyTimeout,
 	}
 
 	for _, opt := range opts {
@@ -85,108 +115,700 @@ func NewRenderer(cli client.Client, emb embed.FS, opts ...Option) *Renderer {
 	return ctrl
 }
 
-// Apply applies provided overlay and creates objects in the kubernetes API using internal client.
-// In case of failures there is no rollback so it is possible that this ends up partially creating
-// the objects (returns at the first failure). Prior to object creation this function feeds all
-// registered OMutators with the objects allowing for last time adjusts. Mutations in the default
-// kustomization.yaml are also executed here.
-func (r *Renderer) Apply(ctx context.Context, overlay string) error {
-	objs, err := r.parse(ctx, overlay)
+// NewRendererFromDir returns a kustomize renderer reading and applying files from a directory
+// on disk. The directory is expected to contain the 'kustomize' directory as documented in the
+// Renderer struct. Files are read every time the Renderer needs them.
+func NewRendererFromDir(cli client.Client, dir string, opts ...Option) *Renderer {
+	return NewRenderer(cli, os.DirFS(dir), opts...)
+}
+
+// Render renders the provided overlay and returns the resulting objects without reaching out to
+// the kubernetes API. All registered mutators (FS, Kustomize and Object) are executed so the
+// returned objects are exactly the ones Apply and Delete work with.
+func (r *Renderer) Render(ctx context.Context, overlay string) ([]client.Object, error) {
+	objs, _, err := r.render(ctx, overlay)
+	return objs, err
+}
+
+// render renders the provided overlay and runs all object mutators. Besides the objects it
+// also returns the source for each typed object, see source struct.
+func (r *Renderer) render(
+	ctx context.Context, overlay string,
+) ([]client.Object, map[client.Object]*source, error) {
+	objs, sources, err := r.parse(ctx, overlay)
 	if err != nil {
-		return fmt.Errorf("error parsing kustomize files: %w", err)
+		return nil, nil, &renderError{fmt.Errorf("error parsing kustomize files: %w", err)}
 	}
+
 	for _, obj := range objs {
 		for _, mut := range r.omutators {
 			if err := mut(ctx, obj); err != nil {
-				return fmt.Errorf("error mutating object: %w", err)
+				return nil, nil, &renderError{r.objectError(obj, PhaseMutate, err)}
 			}
 		}
+	}
+	return objs, sources, nil
+}
 
-		opts := []client.PatchOption{client.FieldOwner(r.fieldOwner)}
-		if r.forceOwner {
-			opts = append(opts, client.ForceOwnership)
+// Apply applies provided overlay and creates objects in the kubernetes API using internal client.
+// Unless WithRollback is used there is no rollback in case of failures so it is possible that
+// this ends up partially creating the objects (returns at the first failure). Objects are
+// rendered through Render so all the registered mutators are executed prior to object creation.
+// If an inventory is configured the applied objects are recorded in it and, if pruning is
+// enabled, objects that are not part of the overlay anymore are deleted. Objects are applied in
+// stages according to their kinds: Namespaces and CRDs go first (and we wait for the CRDs to be
+// Established), then policies, RBAC, configuration, workloads and finally custom resources.
+// Objects can also be split into waves through the WaveAnnotation and DependsOnAnnotation
+// annotations, each wave is applied only after all objects in the previous one are ready.
+// Returns the outcome for each object, on failure the returned result holds the objects
+// processed so far.
+func (r *Renderer) Apply(ctx context.Context, overlay string) (*Result, error) {
+	return r.apply(ctx, overlay, r.dryRun)
+}
+
+// DryRun applies the provided overlay using server side dry-run, nothing is persisted in the
+// cluster. Objects go through all admission controllers (webhooks, schema validation, quotas)
+// and are returned as the API server would have persisted them. Post apply actions are not
+// executed as no object is really created.
+func (r *Renderer) DryRun(ctx context.Context, overlay string) ([]client.Object, error) {
+	res, err := r.apply(ctx, overlay, true)
+	if err != nil {
+		return nil, err
+	}
+	return res.objects(), nil
+}
+
+// apply renders and applies the provided overlay. If dryRun is set all requests are sent with
+// client.DryRunAll and post apply actions are skipped. Returns the result of the operation on
+// each object, on failure the returned result holds the objects processed so far.
+func (r *Renderer) apply(ctx context.Context, overlay string, dryRun bool) (*Result, error) {
+	objs, sources, err := r.render(ctx, overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous, current inventory
+	if r.invName != "" {
+		if current, err = r.inventoryOf(objs); err != nil {
+			return nil, err
 		}
 
-		err := r.cli.Patch(ctx, obj, client.Apply, opts...)
-		if err != nil {
-			if !errors.IsNotFound(err) {
-				return fmt.Errorf("error patching object: %w", err)
-			}
+		if previous, err = r.readInventory(ctx); err != nil {
+			return nil, err
+		}
+	}
 
-			// XXX some verions of kubernetes fails to patch objects that do not
-			// exist, at least I have seen this error in the past, this is kept
-			// here for backwards compability. This should be removed in the future.
-			if err := r.cli.Create(ctx, obj); err != nil {
-				return fmt.Errorf("error creating object: %w", err)
-			}
+	waves, err := r.waves(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	ignored, err := r.ignoredFields(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	recreate, err := r.recreatable(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	op := &operation{
+		dryRun:   dryRun,
+		ignored:  ignored,
+		recreate: recreate,
+		sources:  sources,
+		result:   &Result{},
+		failed:   map[client.Object]bool{},
+	}
+
+	// we record everything we are about to apply before doing so,
+	// this way if we fail half way through we still know about
+	// the objects we have created.
+	if r.invName != "" && !dryRun {
+		union := inventory{}
+		for _, ref := range previous {
+			union.add(ref)
+		}
+		for _, ref := range current {
+			union.add(ref)
+		}
+
+		if err := r.recordInventory(ctx, op, objs, union); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.applyWaves(ctx, op, waves)
+	if err == nil && len(op.errs) > 0 {
+		err = &AggregateError{Errors: op.errs}
+	}
+
+	if err != nil {
+		if r.rollback && !dryRun {
+			return op.result, r.rollbackOperation(ctx, op, err)
 		}
+		return op.result, err
+	}
+
+	if r.invName == "" {
+		return op.result, nil
+	}
+
+	if r.prune {
+		if err := r.pruneInventory(ctx, op, previous, current); err != nil {
+			return op.result, err
+		}
+	}
 
-		for _, action := range r.postApply {
-			if err := action(ctx, obj); err != nil {
-				return fmt.Errorf("error running post apply action: %w", err)
+	if !dryRun {
+		if err := r.writeInventory(ctx, current); err != nil {
+			return op.result, err
+		}
+	}
+	return op.result, nil
+}
+
+// operation holds the state of a single Apply call. When the Renderer is configured to continue
+// on errors, errs holds the errors found so far and failed the objects that failed. If the
+// inventory namespace is part of the overlay, pending holds the inventory to be written once
+// the namespace (pendingAfter) has been applied.
+type operation struct {
+	dryRun       bool
+	diff         bool
+	sources      map[client.Object]*source
+	ignored      map[client.Object][]fieldPath
+	recreate     map[client.Object]bool
+	pending      inventory
+	pendingAfter client.Object
+	journal      []snapshot
+	journalMtx   sync.Mutex
+	postApplyMtx sync.Mutex
+	result       *Result
+	errs         []error
+	failed       map[client.Object]bool
+}
+
+// handle decides what to do with an error found during the operation. If the Renderer has been
+// configured to continue on errors the error is recorded and nil is returned, otherwise the
+// error is returned as is.
+func (r *Renderer) handle(op *operation, err error) error {
+	if err == nil || !r.continueOnError {
+		return err
+	}
+
+	op.errs = append(op.errs, flatten(err)...)
+	return nil
+}
+
+// succeeded returns the provided objects except the ones that failed during the operation.
+func (op *operation) succeeded(objs []client.Object) []client.Object {
+	result := make([]client.Object, 0, len(objs))
+	for _, obj := range objs {
+		if !op.failed[obj] {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// applyWaves applies the provided waves in order. Between waves we wait for the objects in the
+// previous wave to become ready.
+func (r *Renderer) applyWaves(ctx context.Context, op *operation, waves [][]client.Object) error {
+	for i, wave := range waves {
+		if err := r.applyWave(ctx, op, wave); err != nil {
+			return err
+		}
+
+		if op.dryRun || (i == len(waves)-1 && !r.waitReady) {
+			continue
+		}
+
+		if err := r.handle(op, r.awaitReady(ctx, op.succeeded(wave))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyWave applies all objects in a wave. Objects are applied in stages, see stages().
+func (r *Renderer) applyWave(ctx context.Context, op *operation, objs []client.Object) error {
+	stages, err := r.stages(objs)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range stages {
+		if err := r.applyStage(ctx, op, stage); err != nil {
+			return err
+		}
+
+		if err := r.flushInventory(ctx, op, stage); err != nil {
+			return err
+		}
+
+		if op.dryRun {
+			continue
+		}
+
+		if err := r.handle(op, r.awaitCRDs(ctx, op.succeeded(stage))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyStage applies all objects in a stage. Objects in a stage do not depend on each other so
+// they are applied concurrently, up to the Renderer concurrency. Outcomes are recorded in the
+// operation result in the order objects were rendered regardless of the order in which they
+// were applied. Unless continuing on errors no new object is applied after a failure and the
+// error for the first failed object is returned.
+func (r *Renderer) applyStage(ctx context.Context, op *operation, objs []client.Object) error {
+	workers := r.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mtx sync.Mutex
+	var aborted bool
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	results := make([]*ObjectResult, len(objs))
+	errs := make([]error, len(objs))
+	for i, obj := range objs {
+		sem <- struct{}{}
+
+		mtx.Lock()
+		stop := aborted
+		mtx.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, obj client.Object) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := r.applyObject(ctx, op, obj)
+			results[i], errs[i] = &res, err
+			if err != nil && !r.continueOnError {
+				mtx.Lock()
+				aborted = true
+				mtx.Unlock()
 			}
+		}(i, obj)
+	}
+	wg.Wait()
+
+	for i, obj := range objs {
+		if results[i] == nil {
+			continue
+		}
+
+		op.result.Objects = append(op.result.Objects, *results[i])
+		if errs[i] == nil {
+			continue
+		}
+
+		op.failed[obj] = true
+		if err := r.handle(op, errs[i]); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// applyObject applies a single object and returns its outcome. Post apply actions are executed
+// once the object has been applied. This function may be called concurrently.
+func (r *Renderer) applyObject(
+	ctx context.Context, op *operation, obj client.Object,
+) (ObjectResult, error) {
+	start := time.Now()
+	res, err := r.objectResult(obj)
+	if err != nil {
+		return res, err
+	}
+
+	err = r.applyAndRecord(ctx, op, obj, &res)
+	res.Duration = time.Since(start)
+	res.ResourceVersion = obj.GetResourceVersion()
+	res.Generation = obj.GetGeneration()
+	if err != nil {
+		res.Action = ActionFailed
+		res.Err = err
+	}
+	return res, err
+}
+
+// applyAndRecord applies the provided object and sets the action taken in the provided result.
+func (r *Renderer) applyAndRecord(
+	ctx context.Context, op *operation, obj client.Object, res *ObjectResult,
+) error {
+	if err := r.prepare(obj); err != nil {
+		return r.objectError(obj, PhaseMutate, err)
+	}
+
+	if r.rollback && !op.dryRun {
+		if err := r.snapshot(ctx, op, obj); err != nil {
+			return r.objectError(obj, PhaseRead, err)
+		}
+	}
+
+	prior, err := r.metadata(ctx, obj)
+	if err != nil {
+		return r.objectError(obj, PhaseRead, err)
+	}
+
+	// if the live object has been applied with the same hash we have
+	// nothing to do, we just copy the metadata we know about. objects
+	// being deleted are applied anyway as they are about to be gone.
+	hash := obj.GetAnnotations()[HashAnnotation]
+	if r.skipUnchanged &&
+		prior != nil &&
+		prior.GetDeletionTimestamp() == nil &&
+		prior.GetAnnotations()[HashAnnotation] == hash {
+		obj.SetResourceVersion(prior.GetResourceVersion())
+		obj.SetGeneration(prior.GetGeneration())
+		obj.SetUID(prior.GetUID())
+		res.Action = ActionUnchanged
+		res.Message = "object hash unchanged, patch skipped"
+		return r.postApplyActions(ctx, op, obj)
+	}
+
+	// managed fields are migrated only once, as soon as they are
+	// migrated the legacy managers are gone.
+	if len(r.legacyManagers) > 0 && prior != nil && !op.dryRun {
+		if err := r.migrateManagedFields(ctx, obj, prior); err != nil {
+			return r.objectError(obj, PhasePatch, err)
+		}
+	}
+
+	err = r.patch(ctx, op, obj)
+	if err != nil {
+		var msg string
+		if msg, err = r.recoverPatch(ctx, op, obj, err); err == nil {
+			res.Action = ActionRecreated
+			res.Message = msg
+			return r.postApplyActions(ctx, op, obj)
+		}
+
+		if lost(err) {
+			res.Message = "object deleted but not created again, it no longer exists"
+		}
+	}
+
+	if err != nil {
+		if reason, ok := skipped(err); ok {
+			res.Action = ActionSkipped
+			res.Message = reason
+			return nil
+		}
+		return err
+	}
+
+	// dry-run requests do not bump the resource version so we can't
+	// tell if an existing object would have been changed or not.
+	switch {
+	case prior == nil:
+		res.Action = ActionCreated
+	case !op.dryRun && prior.GetResourceVersion() == obj.GetResourceVersion():
+		res.Action = ActionUnchanged
+	default:
+		res.Action = ActionUpdated
+	}
+
+	return r.postApplyActions(ctx, op, obj)
+}
+
+// postApplyActions runs all registered post apply actions for the provided object. Actions are
+// not executed in dry-run mode.
+func (r *Renderer) postApplyActions(ctx context.Context, op *operation, obj client.Object) error {
+	if op.dryRun {
+		return nil
+	}
+
+	// post apply actions are never called concurrently, users
+	// should not be required to write thread safe actions.
+	op.postApplyMtx.Lock()
+	defer op.postApplyMtx.Unlock()
+	for _, action := range r.postApply {
+		if err := action(ctx, obj); err != nil {
+			return r.objectError(obj, PhasePostApply, err)
+		}
+	}
+	return nil
+}
+
+// prepare makes the last adjustments on an object before it is sent to the API server. The
+// object is labeled as part of the inventory, annotations that are only meaningful for the
+// Renderer are removed and, if skipping unchanged objects, the object hash is stamped.
+func (r *Renderer) prepare(obj client.Object) error {
+	r.track(obj)
+	strip(obj)
+	if !r.skipUnchanged {
+		return nil
+	}
+
+	if err := stamp(obj); err != nil {
+		return fmt.Errorf("error computing object hash: %w", err)
+	}
+	return nil
+}
+
+// patch sends a server side apply patch for the provided object, the object is updated with
+// the content returned by the API server. Only the fields present in the rendered manifests (or
+// set by mutators) are sent, see payload(). If the operation is a dry-run the request is sent
+// using server side dry-run and nothing is persisted.
+func (r *Renderer) patch(ctx context.Context, op *operation, obj client.Object) error {
+	opts := []client.PatchOption{client.FieldOwner(r.fieldOwner)}
+	if r.forceOwner {
+		opts = append(opts, client.ForceOwnership)
+	}
+
+	copts := []client.CreateOption{client.FieldOwner(r.fieldOwner)}
+	if op.dryRun {
+		opts = append(opts, client.DryRunAll)
+		copts = append(copts, client.DryRunAll)
+	}
+
+	applied, err := payload(obj, op.sources[obj])
+	if err != nil {
+		return r.objectError(obj, PhasePatch, err)
+	}
+
+	if fields := op.ignored[obj]; len(fields) > 0 {
+		if applied, err = r.releaseFields(ctx, obj, applied, fields); err != nil {
+			return r.objectError(obj, PhaseRead, err)
+		}
+	}
+
+	err = r.retry(ctx, func() error {
+		return r.cli.Patch(ctx, applied, client.Apply, opts...)
+	})
+	if conflict := asConflict(err); conflict != nil {
+		// when diffing we report the conflict instead of resolving it
+		// as the conflict policy may have side effects.
+		err = conflict
+		if !op.diff {
+			err = r.resolveConflict(ctx, obj, applied, conflict, opts)
+		}
+	}
+
+	if err == nil {
+		if err := update(obj, applied); err != nil {
+			return r.objectError(obj, PhasePatch, err)
+		}
+		return nil
+	}
+
+	if !errors.IsNotFound(err) {
+		return r.objectError(obj, PhasePatch, err)
+	}
+
+	// XXX some verions of kubernetes fails to patch objects that do not
+	// exist, at least I have seen this error in the past, this is kept
+	// here for backwards compability. This should be removed in the future.
+	if err := r.retry(ctx, func() error {
+		return r.cli.Create(ctx, applied, copts...)
+	}); err != nil {
+		return r.objectError(obj, PhaseCreate, err)
+	}
+
+	if err := update(obj, applied); err != nil {
+		return r.objectError(obj, PhaseCreate, err)
+	}
+	return nil
+}
+
 // Delete renders in memory the provided overlay and deletes all resulting objects from the
 // kubernetes API. In case of failures there is no rollback so it is possible that this ends
-// up partially deleting the objects (returns at the first failure).
-func (r *Renderer) Delete(ctx context.Context, overlay string) error {
-	objs, err := r.parse(ctx, overlay)
+// up partially deleting the objects (returns at the first failure unless WithContinueOnError
+// is used). If the Renderer has been configured with WithDryRun the deletion is only simulated
+// by the API server. Deleted objects are also removed from the inventory, if one is configured.
+// Objects are deleted in the reverse order they are applied (last wave first). Objects that
+// were not applied by this Renderer (no inventory label nor field owner) are skipped. Returns
+// the outcome for each object.
+func (r *Renderer) Delete(ctx context.Context, overlay string) (*Result, error) {
+	objs, err := r.Render(ctx, overlay)
 	if err != nil {
-		return fmt.Errorf("error parsing kustomize files: %w", err)
+		return nil, err
 	}
 
-	for _, obj := range objs {
-		for _, mut := range r.omutators {
-			if err := mut(ctx, obj); err != nil {
-				return fmt.Errorf("error mutating object: %w", err)
-			}
+	waves, err := r.waves(objs)
+	if err != nil {
+		return nil, &renderError{err}
+	}
+
+	var errs []error
+	result := &Result{}
+	failed := map[client.Object]bool{}
+	for i := len(waves) - 1; i >= 0; i-- {
+		stages, err := r.stages(waves[i])
+		if err != nil {
+			return result, err
 		}
-		if err := r.cli.Delete(ctx, obj); err != nil {
-			if errors.IsNotFound(err) {
-				continue
+
+		for _, stage := range reversed(stages) {
+			for _, obj := range stage {
+				res, err := r.deleteObject(ctx, obj)
+				result.Objects = append(result.Objects, res)
+				if err == nil {
+					continue
+				}
+
+				if !r.continueOnError {
+					return result, err
+				}
+
+				errs = append(errs, err)
+				failed[obj] = true
 			}
-			return fmt.Errorf("error deleting object: %w", err)
 		}
 	}
-	return nil
+
+	var derr error
+	if len(errs) > 0 {
+		derr = &AggregateError{Errors: errs}
+	}
+
+	if r.invName == "" || r.dryRun {
+		return result, derr
+	}
+
+	// deleted objects are removed from the inventory, if nothing is
+	// left the inventory itself is removed from the cluster.
+	inv, err := r.readInventory(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, obj := range objs {
+		if failed[obj] {
+			continue
+		}
+
+		ref, err := r.reference(obj)
+		if err != nil {
+			return result, err
+		}
+		delete(inv, ref.key())
+	}
+
+	if err := r.writeInventory(ctx, inv); err != nil {
+		return result, err
+	}
+	return result, derr
+}
+
+// deleteObject deletes the provided object and returns the outcome. Objects we don't own (see
+// owned) are skipped. If the Renderer has been configured with WithWaitForDeletion this only
+// returns once the object is gone.
+func (r *Renderer) deleteObject(ctx context.Context, obj client.Object) (ObjectResult, error) {
+	start := time.Now()
+	res, err := r.objectResult(obj)
+	if err != nil {
+		return res, err
+	}
+
+	keep, err := r.kept(obj)
+	if err != nil {
+		return res, err
+	}
+
+	if keep {
+		res.Action = ActionSkipped
+		res.Message = "object protected by on-delete policy, not deleted"
+		return res, nil
+	}
+
+	// objects with the same name may have been created by someone
+	// else, we only delete the ones we know we have applied.
+	live, err := r.metadata(ctx, obj)
+	if err != nil {
+		res.Action = ActionFailed
+		res.Err = r.objectError(obj, PhaseRead, err)
+		return res, res.Err
+	}
+
+	if live == nil {
+		res.Action = ActionSkipped
+		res.Message = "object not found"
+		return res, nil
+	}
+
+	if !r.owned(live) {
+		res.Action = ActionSkipped
+		res.Message = "warning: object not owned by us, not deleted"
+		return res, nil
+	}
+
+	opts := r.deleteOptions(r.dryRun)
+	res.Action = ActionDeleted
+	err = r.retry(ctx, func() error {
+		return r.cli.Delete(ctx, obj, opts...)
+	})
+	if err == nil && r.waitDeleted && !r.dryRun {
+		res.Message, err = r.awaitDeletion(ctx, obj)
+		res.Duration = time.Since(start)
+		if err != nil {
+			res.Action = ActionFailed
+			res.Err = err
+		}
+		return res, err
+	}
+
+	res.Duration = time.Since(start)
+	if err == nil {
+		return res, nil
+	}
+
+	if errors.IsNotFound(err) {
+		res.Action = ActionSkipped
+		res.Message = "object not found"
+		return res, nil
+	}
+
+	res.Action = ActionFailed
+	res.Err = r.objectError(obj, PhaseDelete, err)
+	return res, res.Err
 }
 
 // parse reads kustomize files and returns them all parsed as valid client.Object structs. Loads
-// everything from the embed.FS into a filesys.FileSystem instance, mutates the base kustomization
-// and returns the objects as a slice of client.Object.
-func (r *Renderer) parse(ctx context.Context, overlay string) ([]client.Object, error) {
-	virtfs, err := LoadFS(r.from)
+// everything from the fs.FS into a filesys.FileSystem instance, mutates the base kustomization
+// and returns the objects as a slice of client.Object. Kustomize outputs are cached, see the
+// kustomize() function. For typed objects the source (see source struct) is also returned.
+func (r *Renderer) parse(
+	ctx context.Context, overlay string,
+) ([]client.Object, map[client.Object]*source, error) {
+	virtfs, err := r.filesystem()
 	if err != nil {
-		return nil, fmt.Errorf("unable to load overlay: %w", err)
+		return nil, nil, fmt.Errorf("unable to load overlay: %w", err)
 	}
 
 	for _, mut := range r.fsmutators {
 		if err := mut(ctx, virtfs); err != nil {
-			return nil, fmt.Errorf("error mutating filesystem: %w", err)
+			return nil, nil, fmt.Errorf("error mutating filesystem: %w", err)
 		}
 	}
 
 	if err := r.mutateKustomization(ctx, virtfs); err != nil {
-		return nil, fmt.Errorf("error setting object name prefix: %w", err)
+		return nil, nil, fmt.Errorf("error setting object name prefix: %w", err)
 	}
 
-	res, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(
-		virtfs, path.Join("kustomize", overlay),
-	)
+	res, err := r.kustomize(virtfs, overlay)
 	if err != nil {
-		return nil, fmt.Errorf("error running kustomize: %w", err)
+		return nil, nil, fmt.Errorf("error running kustomize: %w", err)
 	}
 
 	var objs []client.Object
+	sources := map[client.Object]*source{}
 	for _, rsc := range res.Resources() {
 		if r.unstructured {
 			clientobj, err := r.unstructuredObject(rsc)
 			if err != nil {
-				return nil, fmt.Errorf("error converting type to unstructure: %w", err)
+				return nil, nil, fmt.Errorf("error converting type to unstructure: %w", err)
 			}
 			objs = append(objs, clientobj)
 			continue
@@ -194,11 +816,24 @@ func (r *Renderer) parse(ctx context.Context, overlay string) ([]client.Object,
 
 		clientobj, err := r.typedObject(rsc)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		objs = append(objs, clientobj)
+
+		// we keep the rendered version of the typed object so later on
+		// we can send only the fields present in the manifest.
+		rendered, err := rsc.MarshalJSON()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshaling resource: %w", err)
+		}
+
+		pristine, err := json.Marshal(clientobj)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshaling object: %w", err)
+		}
+		sources[clientobj] = &source{rendered: rendered, pristine: pristine}
 	}
-	return objs, nil
+	return objs, sources, nil
 }
 
 // unstructuredObject converts a kustomize resource into a client.Object. This is useful when
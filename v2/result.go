@@ -0,0 +1,114 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Action is the action taken on an object during an Apply or a Delete.
+type Action string
+
+const (
+	// ActionCreated means the object did not exist and has been created.
+	ActionCreated Action = "created"
+	// ActionUpdated means the object existed and has been changed.
+	ActionUpdated Action = "updated"
+	// ActionUnchanged means the object existed and has been left untouched.
+	ActionUnchanged Action = "unchanged"
+	// ActionRecreated means the object has been deleted and created again as some of its
+	// immutable fields have changed.
+	ActionRecreated Action = "recreated"
+	// ActionDeleted means the object has been deleted.
+	ActionDeleted Action = "deleted"
+	// ActionPruned means the object has been deleted as it is not part of the inventory anymore.
+	ActionPruned Action = "pruned"
+	// ActionSkipped means nothing has been done with the object, see the result Message.
+	ActionSkipped Action = "skipped"
+	// ActionFailed means the operation on the object failed, see the result Err.
+	ActionFailed Action = "failed"
+)
+
+// ObjectResult is the outcome of an Apply or a Delete for a single object. ResourceVersion and
+// Generation are the ones returned by the API server, Object is the object as returned by the
+// API server as well. Duration is how long it took to process the object.
+type ObjectResult struct {
+	GVK             schema.GroupVersionKind
+	Namespace       string
+	Name            string
+	Action          Action
+	Message         string
+	ResourceVersion string
+	Generation      int64
+	Duration        time.Duration
+	Object          client.Object
+	Err             error
+}
+
+// Result is the outcome of an Apply or a Delete. Objects are listed in the order they were
+// processed.
+type Result struct {
+	Objects []ObjectResult
+}
+
+// Filter returns the results for objects on which the provided action was taken.
+func (r *Result) Filter(action Action) []ObjectResult {
+	var result []ObjectResult
+	for _, obj := range r.Objects {
+		if obj.Action == action {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// objects returns the objects present in the result.
+func (r *Result) objects() []client.Object {
+	objs := make([]client.Object, 0, len(r.Objects))
+	for _, res := range r.Objects {
+		objs = append(objs, res.Object)
+	}
+	return objs
+}
+
+// objectResult returns an ObjectResult for the provided object. Action is not set.
+func (r *Renderer) objectResult(obj client.Object) (ObjectResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return ObjectResult{}, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	return ObjectResult{
+		GVK:       gvk,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Object:    obj,
+	}, nil
+}
+
+// metadata reads the live metadata for the provided object. Returns nil if the object does not
+// exist. This is a cheap read as only the object metadata is retrieved.
+func (r *Renderer) metadata(
+	ctx context.Context, obj client.Object,
+) (*metav1.PartialObjectMetadata, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return nil, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	meta := &metav1.PartialObjectMetadata{}
+	meta.SetGroupVersionKind(gvk)
+	if err := r.cli.Get(ctx, client.ObjectKeyFromObject(obj), meta); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading object metadata: %w", err)
+	}
+	return meta, nil
+}
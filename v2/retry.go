@@ -0,0 +1,135 @@
+package plumber
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// RetryPolicy determines how failed calls to the API server are retried. Calls are retried with
+// an exponential backoff starting at InitialInterval, multiplied by Multiplier after each retry
+// and capped at MaxInterval. Each interval is randomized by +/- Jitter (a fraction between 0
+// and 1). No new attempt is made after MaxElapsedTime has passed since the first one (0 means
+// no limit). Retriable decides if an error is worth retrying, if nil IsTransient is used.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	MaxElapsedTime  time.Duration
+	Retriable       func(error) bool
+}
+
+// DefaultRetryPolicy returns a retry policy suitable for most cases. Transient errors are
+// retried for up to two minutes.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  2 * time.Minute,
+		Retriable:       IsTransient,
+	}
+}
+
+// IsTransient returns true if the provided error is likely to go away if the call is retried.
+// This includes conflicts (except server side apply field conflicts), timeouts, throttling,
+// unavailable API servers and failures calling admission webhooks (commonly seen when the
+// webhook has just been deployed).
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.IsConflict(err) {
+		return !isFieldConflict(err)
+	}
+
+	if errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) ||
+		errors.IsServiceUnavailable(err) ||
+		utilnet.IsConnectionReset(err) ||
+		utilnet.IsConnectionRefused(err) ||
+		utilnet.IsProbableEOF(err) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "failed calling webhook") ||
+		strings.Contains(msg, "no endpoints available")
+}
+
+// isFieldConflict returns true if the error is a server side apply conflict between managers.
+func isFieldConflict(err error) bool {
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		return false
+	}
+
+	details := status.Status().Details
+	if details == nil {
+		return false
+	}
+
+	for _, cause := range details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn until it succeeds, it fails with an error that is not retriable or the policy
+// gives up. This is a direct call to fn if the Renderer has no retry policy. Returns the last
+// error returned by fn.
+func (r *Renderer) retry(ctx context.Context, fn func() error) error {
+	if r.retryPolicy == nil {
+		return fn()
+	}
+
+	policy := *r.retryPolicy
+	if policy.Retriable == nil {
+		policy.Retriable = IsTransient
+	}
+
+	start := time.Now()
+	interval := policy.InitialInterval
+	for {
+		err := fn()
+		if err == nil || !policy.Retriable(err) {
+			return err
+		}
+
+		delay := interval
+		if policy.Jitter > 0 {
+			delta := policy.Jitter * float64(interval)
+			delay = time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+		}
+
+		if policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if policy.Multiplier > 0 {
+			interval = time.Duration(float64(interval) * policy.Multiplier)
+		}
+		if policy.MaxInterval > 0 && interval > policy.MaxInterval {
+			interval = policy.MaxInterval
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package plumber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIsTransient(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	for _, tt := range []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "not found",
+			err:  apierrors.NewNotFound(gr, "cm"),
+		},
+		{
+			name: "invalid",
+			err:  apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "cm", nil),
+		},
+		{
+			name: "field manager conflict",
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{
+					{
+						Type:    metav1.CauseTypeFieldManagerConflict,
+						Message: `conflict with "helm" using v1`,
+						Field:   ".data.key",
+					},
+				},
+				"Apply failed with 1 conflict",
+			),
+		},
+		{
+			name:     "resource version conflict",
+			err:      apierrors.NewConflict(gr, "cm", errors.New("object has been modified")),
+			expected: true,
+		},
+		{
+			name:     "server timeout",
+			err:      apierrors.NewServerTimeout(gr, "patch", 1),
+			expected: true,
+		},
+		{
+			name:     "timeout",
+			err:      apierrors.NewTimeoutError("timeout", 1),
+			expected: true,
+		},
+		{
+			name:     "too many requests",
+			err:      apierrors.NewTooManyRequests("slow down", 1),
+			expected: true,
+		},
+		{
+			name:     "service unavailable",
+			err:      apierrors.NewServiceUnavailable("unavailable"),
+			expected: true,
+		},
+		{
+			name:     "connection refused",
+			err:      fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+			expected: true,
+		},
+		{
+			name:     "unexpected eof",
+			err:      io.ErrUnexpectedEOF,
+			expected: true,
+		},
+		{
+			name: "webhook failure",
+			err: apierrors.NewInternalError(errors.New(
+				`failed calling webhook "validate.example.com": connection refused`,
+			)),
+			expected: true,
+		},
+		{
+			name:     "webhook without endpoints",
+			err:      errors.New(`no endpoints available for service "webhook"`),
+			expected: true,
+		},
+		{
+			name: "generic error",
+			err:  errors.New("something went wrong"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if transient := IsTransient(tt.err); transient != tt.expected {
+				t.Errorf("expected %v, received %v", tt.expected, transient)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := apierrors.NewServiceUnavailable("unavailable")
+	for _, tt := range []struct {
+		name     string
+		policy   *RetryPolicy
+		failures int
+		err      error
+		timeout  time.Duration
+		attempts int
+		fails    bool
+	}{
+		{
+			name:     "no policy",
+			failures: 3,
+			err:      transient,
+			attempts: 1,
+			fails:    true,
+		},
+		{
+			name: "succeeds after transient failures",
+			policy: &RetryPolicy{
+				InitialInterval: time.Millisecond,
+				Multiplier:      2,
+			},
+			failures: 3,
+			err:      transient,
+			attempts: 4,
+		},
+		{
+			name: "non retriable error",
+			policy: &RetryPolicy{
+				InitialInterval: time.Millisecond,
+			},
+			failures: 3,
+			err:      apierrors.NewNotFound(schema.GroupResource{}, "cm"),
+			attempts: 1,
+			fails:    true,
+		},
+		{
+			name: "field manager conflict",
+			policy: &RetryPolicy{
+				InitialInterval: time.Millisecond,
+			},
+			failures: 3,
+			err: apierrors.NewApplyConflict(
+				[]metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict}},
+				"Apply failed with 1 conflict",
+			),
+			attempts: 1,
+			fails:    true,
+		},
+		{
+			name: "custom retriable",
+			policy: &RetryPolicy{
+				InitialInterval: time.Millisecond,
+				Retriable: func(err error) bool {
+					return err != nil
+				},
+			},
+			failures: 2,
+			err:      errors.New("custom"),
+			attempts: 3,
+		},
+		{
+			name: "max elapsed time",
+			policy: &RetryPolicy{
+				InitialInterval: 20 * time.Millisecond,
+				Multiplier:      2,
+				MaxElapsedTime:  50 * time.Millisecond,
+			},
+			failures: 10,
+			err:      transient,
+			// attempts at 0ms and 20ms, the next one would start past 50ms.
+			attempts: 2,
+			fails:    true,
+		},
+		{
+			name: "max interval",
+			policy: &RetryPolicy{
+				InitialInterval: time.Millisecond,
+				Multiplier:      100,
+				MaxInterval:     2 * time.Millisecond,
+				MaxElapsedTime:  time.Second,
+			},
+			failures: 5,
+			err:      transient,
+			attempts: 6,
+		},
+		{
+			name: "context cancelled",
+			policy: &RetryPolicy{
+				InitialInterval: time.Hour,
+			},
+			failures: 10,
+			err:      transient,
+			timeout:  20 * time.Millisecond,
+			attempts: 1,
+			fails:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := testRenderer(testFS())
+			renderer.retryPolicy = tt.policy
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			var attempts int
+			start := time.Now()
+			err := renderer.retry(ctx, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("retry took too long: %v", time.Since(start))
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("expected %d attempts, received %d", tt.attempts, attempts)
+			}
+
+			if tt.fails && !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v, received %v", tt.err, err)
+			}
+
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// snapshot is the state of an object before it was applied. If the object did not exist
+// prior to being applied, live is nil.
+type snapshot struct {
+	obj  client.Object
+	live *unstructured.Unstructured
+}
+
+// RollbackError is returned by Apply when it fails and its changes are rolled back. Err is the
+// error that caused the rollback and Errors holds the errors found during the rollback itself,
+// if Errors is empty the rollback succeeded.
+type RollbackError struct {
+	Err    error
+	Errors []error
+}
+
+// Error returns the error message, including the errors found during the rollback.
+func (e *RollbackError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("%v (changes rolled back)", e.Err)
+	}
+
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%v (rollback failed: %s)", e.Err, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error that caused the rollback.
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// snapshot saves the live version of the provided object in the operation journal.
+func (r *Renderer) snapshot(ctx context.Context, op *operation, obj client.Object) error {
+	live, err := r.live(ctx, obj)
+	if err != nil {
+		return fmt.Errorf("error taking snapshot: %w", err)
+	}
+
+	op.journalMtx.Lock()
+	defer op.journalMtx.Unlock()
+	op.journal = append(op.journal, snapshot{obj: obj, live: live})
+	return nil
+}
+
+// rollbackOperation restores all objects in the operation journal, in reverse order. Objects
+// that did not exist are deleted while objects that existed are restored to the version saved
+// in the journal. Returns a RollbackError wrapping the provided error.
+func (r *Renderer) rollbackOperation(ctx context.Context, op *operation, cause error) error {
+	rerr := &RollbackError{Err: cause}
+	for i := len(op.journal) - 1; i >= 0; i-- {
+		if err := r.restore(ctx, op.journal[i]); err != nil {
+			rerr.Errors = append(rerr.Errors, err)
+		}
+	}
+	return rerr
+}
+
+// restore restores an object to the state saved in the provided snapshot.
+func (r *Renderer) restore(ctx context.Context, snap snapshot) error {
+	if snap.live == nil {
+		if err := r.cli.Delete(ctx, snap.obj); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting %s: %w", snap.obj.GetName(), err)
+		}
+		return nil
+	}
+
+	current, err := r.live(ctx, snap.live)
+	if err != nil {
+		return err
+	}
+
+	// the object has been deleted in the meantime, we recreate it with
+	// the content we had before.
+	restored := snap.live.DeepCopy()
+	if current == nil {
+		restored.SetResourceVersion("")
+		restored.SetUID("")
+		restored.SetManagedFields(nil)
+		if err := r.cli.Create(ctx, restored, client.FieldOwner(r.fieldOwner)); err != nil {
+			return fmt.Errorf("error recreating %s: %w", snap.obj.GetName(), err)
+		}
+		return nil
+	}
+
+	restored.SetResourceVersion(current.GetResourceVersion())
+	if err := r.cli.Update(ctx, restored); err != nil {
+		return fmt.Errorf("error restoring %s: %w", snap.obj.GetName(), err)
+	}
+	return nil
+}
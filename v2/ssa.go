@@ -0,0 +1,70 @@
+package plumber
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// source keeps, for a typed object, the JSON representation of the object as rendered by
+// kustomize and the JSON representation of the typed object before it was mutated. These are
+// used to compute what needs to be sent over in a server side apply patch.
+type source struct {
+	rendered []byte
+	pristine []byte
+}
+
+// payload returns the object to be sent in a server side apply patch. Typed objects, once
+// marshaled, contain zero valued fields (creationTimestamp, status, etc) that were never part
+// of the rendered manifest. Sending them would make us claim ownership over fields we never
+// meant to manage. For typed objects we send the rendered manifest with all changes made since
+// the object was parsed (by mutators or by the Renderer itself) applied on top. The returned
+// object is unstructured in such case. Objects without a source are returned as is.
+func payload(obj client.Object, src *source) (client.Object, error) {
+	if src == nil {
+		return obj, nil
+	}
+
+	current, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling object: %w", err)
+	}
+
+	patch, err := strategicpatch.CreateTwoWayMergePatch(src.pristine, current, obj)
+	if err != nil {
+		return nil, fmt.Errorf("error computing object changes: %w", err)
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(src.rendered, patch, obj)
+	if err != nil {
+		return nil, fmt.Errorf("error applying object changes: %w", err)
+	}
+
+	result := &unstructured.Unstructured{}
+	if err := result.UnmarshalJSON(merged); err != nil {
+		return nil, fmt.Errorf("error decoding object: %w", err)
+	}
+	return result, nil
+}
+
+// update copies the content returned by the API server (in 'from') into 'to'. This is a no-op
+// if both point to the same object.
+func update(to, from client.Object) error {
+	if to == from {
+		return nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(from)
+	if err != nil {
+		return fmt.Errorf("error converting object: %w", err)
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, to); err != nil {
+		return fmt.Errorf("error converting object: %w", err)
+	}
+	return nil
+}
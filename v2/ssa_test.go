@@ -0,0 +1,161 @@
+package plumber
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// field is a path inside an unstructured object and its expected value.
+type field struct {
+	path  []string
+	value interface{}
+}
+
+func TestPayload(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		mutator  ObjectMutator
+		image    string
+		expected []field
+		absent   [][]string
+	}{
+		{
+			name:  "rendered fields only",
+			image: "app:latest",
+			expected: []field{
+				{path: []string{"spec", "replicas"}, value: int64(3)},
+				{path: []string{"metadata", "annotations", "owner"}, value: "team"},
+			},
+			absent: [][]string{
+				{"metadata", "creationTimestamp"},
+				{"status"},
+				{"spec", "strategy"},
+				{"spec", "template", "metadata", "creationTimestamp"},
+			},
+		},
+		{
+			name:  "mutator changes",
+			image: "app:v2",
+			mutator: func(ctx context.Context, obj client.Object) error {
+				if dep, ok := obj.(*appsv1.Deployment); ok {
+					dep.Spec.Template.Spec.Containers[0].Image = "app:v2"
+					dep.Labels = map[string]string{"mutated": "true"}
+				}
+				return nil
+			},
+			expected: []field{
+				{path: []string{"spec", "replicas"}, value: int64(3)},
+				{path: []string{"metadata", "labels", "mutated"}, value: "true"},
+				{path: []string{"metadata", "annotations", "owner"}, value: "team"},
+			},
+			absent: [][]string{
+				{"metadata", "creationTimestamp"},
+				{"status"},
+				{"spec", "strategy"},
+			},
+		},
+		{
+			name:  "mutator removes an annotation",
+			image: "app:latest",
+			mutator: func(ctx context.Context, obj client.Object) error {
+				obj.SetAnnotations(nil)
+				return nil
+			},
+			expected: []field{
+				{path: []string{"spec", "replicas"}, value: int64(3)},
+			},
+			absent: [][]string{
+				{"metadata", "annotations"},
+				{"metadata", "creationTimestamp"},
+				{"status"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.mutator != nil {
+				opts = append(opts, WithObjectMutator(tt.mutator))
+			}
+
+			renderer := testRenderer(testFS(), opts...)
+			objs, sources, err := renderer.render(context.Background(), "overlay")
+			if err != nil {
+				t.Fatalf("unexpected render error: %v", err)
+			}
+
+			var dep client.Object
+			for _, obj := range objs {
+				if _, ok := obj.(*appsv1.Deployment); ok {
+					dep = obj
+				}
+			}
+
+			if dep == nil {
+				t.Fatal("deployment not rendered")
+			}
+
+			applied, err := payload(dep, sources[dep])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			content := applied.(*unstructured.Unstructured).Object
+			for _, expected := range tt.expected {
+				value, ok, _ := unstructured.NestedFieldNoCopy(content, expected.path...)
+				if !ok {
+					t.Errorf("field %v not found", expected.path)
+					continue
+				}
+
+				if value != expected.value {
+					t.Errorf("expected %v to be %v, found %v", expected.path, expected.value, value)
+				}
+			}
+
+			for _, path := range tt.absent {
+				if _, ok, _ := unstructured.NestedFieldNoCopy(content, path...); ok {
+					t.Errorf("unexpected field %v found", path)
+				}
+			}
+
+			containers, _, _ := unstructured.NestedSlice(
+				content, "spec", "template", "spec", "containers",
+			)
+			if len(containers) != 1 {
+				t.Fatalf("expected one container, found %d", len(containers))
+			}
+
+			container := containers[0].(map[string]interface{})
+			if container["image"] != tt.image {
+				t.Errorf("expected image %s, found %v", tt.image, container["image"])
+			}
+
+			if _, ok := container["resources"]; ok {
+				t.Errorf("unexpected container resources found")
+			}
+		})
+	}
+}
+
+func TestPayloadWithoutSource(t *testing.T) {
+	renderer := testRenderer(testFS(), WithUnstructured())
+	objs, sources, err := renderer.render(context.Background(), "overlay")
+	if err != nil {
+		t.Fatalf("unexpected render error: %v", err)
+	}
+
+	for _, obj := range objs {
+		applied, err := payload(obj, sources[obj])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if applied != obj {
+			t.Errorf("expected %s to be sent as is", obj.GetName())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// forbiddenStatefulSetUpdate returns true if the error has been caused by an attempt to change
+// a StatefulSet field that can't be updated.
+func forbiddenStatefulSetUpdate(err error) bool {
+	return apierrors.IsInvalid(err) &&
+		strings.Contains(err.Error(), "updates to statefulset spec for fields other than")
+}
+
+// claimTemplatesChanged returns true if the provided patch error has been caused by a change
+// in the volume claim templates of a StatefulSet. The live StatefulSet is compared with the
+// provided one, only the requested resources, access modes and storage class are compared.
+func (r *Renderer) claimTemplatesChanged(
+	ctx context.Context, obj client.Object, perr error,
+) (bool, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+	if err != nil {
+		return false, fmt.Errorf("error finding object kind: %w", err)
+	}
+
+	if gvk.Group != appsv1.GroupName || gvk.Kind != "StatefulSet" {
+		return false, nil
+	}
+
+	if !forbiddenStatefulSetUpdate(perr) {
+		return false, nil
+	}
+
+	live, err := r.live(ctx, obj)
+	if err != nil || live == nil {
+		return false, err
+	}
+
+	var before appsv1.StatefulSet
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(
+		live.Object, &before,
+	); err != nil {
+		return false, fmt.Errorf("error converting live object: %w", err)
+	}
+
+	after, err := statefulSet(obj)
+	if err != nil {
+		return false, err
+	}
+
+	templates := map[string]corev1.PersistentVolumeClaim{}
+	for _, tpl := range before.Spec.VolumeClaimTemplates {
+		templates[tpl.Name] = tpl
+	}
+
+	if len(templates) != len(after.Spec.VolumeClaimTemplates) {
+		return true, nil
+	}
+
+	for _, tpl := range after.Spec.VolumeClaimTemplates {
+		prev, ok := templates[tpl.Name]
+		if !ok {
+			return true, nil
+		}
+
+		if !equality.Semantic.DeepEqual(prev.Spec.Resources, tpl.Spec.Resources) ||
+			!equality.Semantic.DeepEqual(prev.Spec.AccessModes, tpl.Spec.AccessModes) ||
+			!equality.Semantic.DeepEqual(prev.Spec.StorageClassName, tpl.Spec.StorageClassName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// statefulSet converts the provided object into a typed StatefulSet.
+func statefulSet(obj client.Object) (*appsv1.StatefulSet, error) {
+	if sts, ok := obj.(*appsv1.StatefulSet); ok {
+		return sts, nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error converting object: %w", err)
+	}
+
+	sts := &appsv1.StatefulSet{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, sts); err != nil {
+		return nil, fmt.Errorf("error converting object: %w", err)
+	}
+	return sts, nil
+}
+
+// expandClaims grows the claims created out of the volume claim templates of the provided
+// StatefulSet so they match the storage requested in the templates. Claims are only expanded
+// if their storage class allows it. Returns the names of the expanded claims and the names of
+// the claims that could not be expanded.
+func (r *Renderer) expandClaims(
+	ctx context.Context, obj client.Object,
+) (expanded, refused []string, err error) {
+	sts, err := statefulSet(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	for _, tpl := range sts.Spec.VolumeClaimTemplates {
+		size, ok := tpl.Spec.Resources.Requests[corev1.ResourceStorage]
+		if !ok {
+			continue
+		}
+
+		for i := int32(0); i < replicas; i++ {
+			key := types.NamespacedName{
+				Namespace: sts.Namespace,
+				Name:      fmt.Sprintf("%s-%s-%d", tpl.Name, sts.Name, i),
+			}
+
+			pvc := &corev1.PersistentVolumeClaim{}
+			if err := r.cli.Get(ctx, key, pvc); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, nil, fmt.Errorf("error reading claim %s: %w", key.Name, err)
+			}
+
+			if pvc.Spec.Resources.Requests.Storage().Cmp(size) >= 0 {
+				continue
+			}
+
+			expandable, err := r.expandable(ctx, pvc)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !expandable {
+				refused = append(refused, pvc.Name)
+				continue
+			}
+
+			patch := client.MergeFrom(pvc.DeepCopy())
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			if err := r.retry(ctx, func() error {
+				return r.cli.Patch(ctx, pvc, patch)
+			}); err != nil {
+				return nil, nil, fmt.Errorf("error expanding claim %s: %w", pvc.Name, err)
+			}
+			expanded = append(expanded, pvc.Name)
+		}
+	}
+	return expanded, refused, nil
+}
+
+// expandable returns true if the storage class of the provided claim allows volume expansion.
+func (r *Renderer) expandable(
+	ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, nil
+	}
+
+	class := &storagev1.StorageClass{}
+	key := types.NamespacedName{Name: *pvc.Spec.StorageClassName}
+	if err := r.cli.Get(ctx, key, class); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading storage class %s: %w", key.Name, err)
+	}
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
@@ -0,0 +1,355 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// DefaultReadyTimeout is the default amount of time we wait for objects to become ready.
+const DefaultReadyTimeout = 5 * time.Minute
+
+// health is the assessed health of an object.
+type health int
+
+const (
+	// healthInProgress means the object is still being reconciled.
+	healthInProgress health = iota
+	// healthReady means the object has been fully reconciled.
+	healthReady
+	// healthFailed means the object won't become ready without intervention.
+	healthFailed
+)
+
+// NotReadyError is returned when an object does not become ready. This happens either when
+// the object is assessed as failed or when it is not ready once the timeout expires. Message
+// is the last observed reason why the object is not ready and Conditions are the last observed
+// conditions present in the object status.
+type NotReadyError struct {
+	GVK        schema.GroupVersionKind
+	Namespace  string
+	Name       string
+	Message    string
+	Conditions []metav1.Condition
+	Err        error
+}
+
+// Error returns the error message, including the object conditions.
+func (e *NotReadyError) Error() string {
+	var conds []string
+	for _, cond := range e.Conditions {
+		str := fmt.Sprintf("%s=%s", cond.Type, cond.Status)
+		if cond.Reason != "" || cond.Message != "" {
+			str = fmt.Sprintf("%s (%s: %s)", str, cond.Reason, cond.Message)
+		}
+		conds = append(conds, str)
+	}
+
+	name := e.Name
+	if e.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", e.Namespace, e.Name)
+	}
+
+	msg := fmt.Sprintf("%s %s is not ready", e.GVK.Kind, name)
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if len(conds) > 0 {
+		msg = fmt.Sprintf("%s, conditions: %s", msg, strings.Join(conds, ", "))
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// conditions returns the conditions present in the provided object status.
+func conditions(obj *unstructured.Unstructured) []metav1.Condition {
+	raw, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	var conds []metav1.Condition
+	for _, item := range raw {
+		cond, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		ctype, _, _ := unstructured.NestedString(cond, "type")
+		status, _, _ := unstructured.NestedString(cond, "status")
+		reason, _, _ := unstructured.NestedString(cond, "reason")
+		message, _, _ := unstructured.NestedString(cond, "message")
+		conds = append(conds, metav1.Condition{
+			Type:    ctype,
+			Status:  metav1.ConditionStatus(status),
+			Reason:  reason,
+			Message: message,
+		})
+	}
+	return conds
+}
+
+// observedKinds are the kinds whose controllers always report the observed generation.
+var observedKinds = map[string]bool{
+	"Deployment.apps":  true,
+	"StatefulSet.apps": true,
+	"DaemonSet.apps":   true,
+}
+
+// readiness assesses the health of the provided object. Returns the health and, if the object
+// is not ready, a message describing why. Known kinds are assessed according to their status
+// fields while any other kind is assessed through the commonly used Ready, Reconciling and
+// Stalled conditions. Objects without conditions are considered ready.
+func readiness(obj *unstructured.Unstructured) (health, string) {
+	kind := obj.GroupVersionKind().GroupKind().String()
+	generation := obj.GetGeneration()
+	observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if found && observed < generation {
+		return healthInProgress, "waiting for the latest generation to be observed"
+	}
+
+	// the status of workloads is meaningless until their controller
+	// has observed them, an empty status reads as all zeroes.
+	if !found && observedKinds[kind] {
+		return healthInProgress, "waiting for the object to be observed by its controller"
+	}
+
+	switch kind {
+	case "Deployment.apps":
+		return deploymentReadiness(obj)
+	case "StatefulSet.apps":
+		return statefulSetReadiness(obj)
+	case "DaemonSet.apps":
+		return daemonSetReadiness(obj)
+	case "Job.batch":
+		return jobReadiness(obj)
+	case "PersistentVolumeClaim":
+		return pvcReadiness(obj)
+	case "Service":
+		return serviceReadiness(obj)
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		return crdReadiness(obj)
+	}
+
+	if hasCondition(obj, "Stalled", "True") {
+		return healthFailed, "object is stalled"
+	}
+
+	if hasCondition(obj, "Reconciling", "True") {
+		return healthInProgress, "object is being reconciled"
+	}
+
+	if _, found, _ := unstructured.NestedSlice(obj.Object, "status", "conditions"); !found {
+		return healthReady, ""
+	}
+
+	for _, cond := range conditions(obj) {
+		if cond.Type != "Ready" {
+			continue
+		}
+
+		if cond.Status != metav1.ConditionTrue {
+			return healthInProgress, "waiting for Ready condition"
+		}
+		return healthReady, ""
+	}
+	return healthReady, ""
+}
+
+// deploymentReadiness returns ready when all replicas of a Deployment are updated and available.
+// A Deployment that exceeded its progress deadline is considered failed.
+func deploymentReadiness(obj *unstructured.Unstructured) (health, string) {
+	for _, cond := range conditions(obj) {
+		if cond.Type == "Progressing" && cond.Reason == "ProgressDeadlineExceeded" {
+			return healthFailed, "progress deadline exceeded"
+		}
+	}
+
+	replicas := int64(1)
+	if val, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); found {
+		replicas = val
+	}
+
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+	if updated < replicas || available < replicas {
+		return healthInProgress, fmt.Sprintf(
+			"%d/%d replicas updated, %d/%d available", updated, replicas, available, replicas,
+		)
+	}
+	return healthReady, ""
+}
+
+// statefulSetReadiness returns ready when all replicas of a StatefulSet are updated and ready.
+// StatefulSets using the OnDelete strategy are only updated when their pods are deleted so we
+// don't wait for them to be updated. With a partitioned rolling update only the replicas with
+// an ordinal at or above the partition are expected to be updated.
+func statefulSetReadiness(obj *unstructured.Unstructured) (health, string) {
+	replicas := int64(1)
+	if val, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); found {
+		replicas = val
+	}
+
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	if ready < replicas {
+		return healthInProgress, fmt.Sprintf("%d/%d replicas ready", ready, replicas)
+	}
+
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return healthReady, ""
+	}
+
+	partition, _, _ := unstructured.NestedInt64(
+		obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition",
+	)
+	if partition > 0 {
+		expected := replicas - partition
+		updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+		if updated < expected {
+			return healthInProgress, fmt.Sprintf("%d/%d replicas updated", updated, expected)
+		}
+		return healthReady, ""
+	}
+
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return healthInProgress, fmt.Sprintf("waiting for revision %s to be rolled out", update)
+	}
+	return healthReady, ""
+}
+
+// daemonSetReadiness returns ready when the DaemonSet pods are updated and available in all
+// the nodes they have been scheduled to.
+func daemonSetReadiness(obj *unstructured.Unstructured) (health, string) {
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+	if updated < desired || available < desired {
+		return healthInProgress, fmt.Sprintf(
+			"%d/%d pods updated, %d/%d available", updated, desired, available, desired,
+		)
+	}
+	return healthReady, ""
+}
+
+// jobReadiness returns ready when the Job has completed and failed if the Job has failed.
+func jobReadiness(obj *unstructured.Unstructured) (health, string) {
+	if hasCondition(obj, "Failed", "True") {
+		return healthFailed, "job has failed"
+	}
+
+	if hasCondition(obj, "Complete", "True") {
+		return healthReady, ""
+	}
+	return healthInProgress, "waiting for job to complete"
+}
+
+// pvcReadiness returns ready when the PersistentVolumeClaim has been bound.
+func pvcReadiness(obj *unstructured.Unstructured) (health, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Bound":
+		return healthReady, ""
+	case "Lost":
+		return healthFailed, "claim lost its volume"
+	default:
+		return healthInProgress, "waiting for claim to be bound"
+	}
+}
+
+// serviceReadiness returns ready for all services except for LoadBalancer services without
+// an ingress address assigned.
+func serviceReadiness(obj *unstructured.Unstructured) (health, string) {
+	stype, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if stype != "LoadBalancer" {
+		return healthReady, ""
+	}
+
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	if len(ingress) == 0 {
+		return healthInProgress, "waiting for load balancer address"
+	}
+	return healthReady, ""
+}
+
+// crdReadiness returns ready when the CustomResourceDefinition has been established.
+func crdReadiness(obj *unstructured.Unstructured) (health, string) {
+	if hasCondition(obj, "NamesAccepted", "False") {
+		return healthFailed, "names not accepted"
+	}
+
+	if !hasCondition(obj, "Established", "True") {
+		return healthInProgress, "waiting for crd to be established"
+	}
+	return healthReady, ""
+}
+
+// awaitReady waits until all provided objects are ready. Objects are read from the cluster
+// and assessed until they are all ready or the Renderer ready timeout expires. Returns an
+// ObjectError wrapping a NotReadyError for the first object that fails or that is not ready
+// in time. When continuing on errors all objects are awaited and an AggregateError is returned.
+func (r *Renderer) awaitReady(ctx context.Context, objs []client.Object) error {
+	ctx, cancel := context.WithTimeout(ctx, r.readyTimeout)
+	defer cancel()
+
+	var errs []error
+
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		var message string
+		var status health
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(gvk)
+		key := client.ObjectKeyFromObject(obj)
+		err = wait.PollImmediateUntilWithContext(
+			ctx, 2*time.Second,
+			func(ctx context.Context) (bool, error) {
+				if err := r.cli.Get(ctx, key, live); err != nil {
+					return false, err
+				}
+
+				status, message = readiness(live)
+				return status != healthInProgress, nil
+			},
+		)
+		if err == nil && status == healthReady {
+			continue
+		}
+
+		err = r.objectError(obj, PhaseWait, &NotReadyError{
+			GVK:        gvk,
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Message:    message,
+			Conditions: conditions(live),
+			Err:        err,
+		})
+		if !r.continueOnError {
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return &AggregateError{Errors: errs}
+	}
+	return nil
+}
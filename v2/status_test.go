@@ -0,0 +1,359 @@
+package plumber
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestReadiness(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		manifest string
+		expected health
+	}{
+		{
+			name: "deployment not observed",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 1
+spec:
+  replicas: 1
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "deployment old generation observed",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 2
+spec:
+  replicas: 1
+status:
+  observedGeneration: 1
+  updatedReplicas: 1
+  availableReplicas: 1
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "deployment available",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 2
+spec:
+  replicas: 2
+status:
+  observedGeneration: 2
+  updatedReplicas: 2
+  availableReplicas: 2
+`,
+			expected: healthReady,
+		},
+		{
+			name: "deployment progress deadline exceeded",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 1
+status:
+  observedGeneration: 1
+  conditions:
+  - type: Progressing
+    status: "False"
+    reason: ProgressDeadlineExceeded
+`,
+			expected: healthFailed,
+		},
+		{
+			name: "daemonset not observed",
+			manifest: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  generation: 1
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "daemonset available",
+			manifest: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  generation: 1
+status:
+  observedGeneration: 1
+  desiredNumberScheduled: 3
+  updatedNumberScheduled: 3
+  numberAvailable: 3
+`,
+			expected: healthReady,
+		},
+		{
+			name: "daemonset rolling out",
+			manifest: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  generation: 1
+status:
+  observedGeneration: 1
+  desiredNumberScheduled: 3
+  updatedNumberScheduled: 1
+  numberAvailable: 3
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "statefulset not observed",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 0
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "statefulset rolled out",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 2
+status:
+  observedGeneration: 1
+  readyReplicas: 2
+  currentRevision: a
+  updateRevision: a
+`,
+			expected: healthReady,
+		},
+		{
+			name: "statefulset rolling out",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 2
+status:
+  observedGeneration: 1
+  readyReplicas: 2
+  currentRevision: a
+  updateRevision: b
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "statefulset on delete",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 2
+  updateStrategy:
+    type: OnDelete
+status:
+  observedGeneration: 1
+  readyReplicas: 2
+  currentRevision: a
+  updateRevision: b
+`,
+			expected: healthReady,
+		},
+		{
+			name: "statefulset partition updated",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 3
+  updateStrategy:
+    type: RollingUpdate
+    rollingUpdate:
+      partition: 2
+status:
+  observedGeneration: 1
+  readyReplicas: 3
+  updatedReplicas: 1
+  currentRevision: a
+  updateRevision: b
+`,
+			expected: healthReady,
+		},
+		{
+			name: "statefulset partition updating",
+			manifest: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  generation: 1
+spec:
+  replicas: 3
+  updateStrategy:
+    type: RollingUpdate
+    rollingUpdate:
+      partition: 1
+status:
+  observedGeneration: 1
+  readyReplicas: 3
+  updatedReplicas: 1
+  currentRevision: a
+  updateRevision: b
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "job running",
+			manifest: `
+apiVersion: batch/v1
+kind: Job
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "job complete",
+			manifest: `
+apiVersion: batch/v1
+kind: Job
+status:
+  conditions:
+  - type: Complete
+    status: "True"
+`,
+			expected: healthReady,
+		},
+		{
+			name: "job failed",
+			manifest: `
+apiVersion: batch/v1
+kind: Job
+status:
+  conditions:
+  - type: Failed
+    status: "True"
+`,
+			expected: healthFailed,
+		},
+		{
+			name: "pvc pending",
+			manifest: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+status:
+  phase: Pending
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "pvc bound",
+			manifest: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+status:
+  phase: Bound
+`,
+			expected: healthReady,
+		},
+		{
+			name: "load balancer without address",
+			manifest: `
+apiVersion: v1
+kind: Service
+spec:
+  type: LoadBalancer
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "cluster ip service",
+			manifest: `
+apiVersion: v1
+kind: Service
+spec:
+  type: ClusterIP
+`,
+			expected: healthReady,
+		},
+		{
+			name: "crd not established",
+			manifest: `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+status:
+  conditions:
+  - type: Established
+    status: "False"
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "custom resource without conditions",
+			manifest: `
+apiVersion: example.com/v1
+kind: Widget
+`,
+			expected: healthReady,
+		},
+		{
+			name: "custom resource not ready",
+			manifest: `
+apiVersion: example.com/v1
+kind: Widget
+status:
+  conditions:
+  - type: Ready
+    status: "False"
+`,
+			expected: healthInProgress,
+		},
+		{
+			name: "custom resource stalled",
+			manifest: `
+apiVersion: example.com/v1
+kind: Widget
+status:
+  conditions:
+  - type: Stalled
+    status: "True"
+`,
+			expected: healthFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yaml.YAMLToJSON([]byte(tt.manifest))
+			if err != nil {
+				t.Fatalf("unexpected error parsing manifest: %v", err)
+			}
+
+			obj := &unstructured.Unstructured{}
+			if err := obj.UnmarshalJSON(data); err != nil {
+				t.Fatalf("unexpected error decoding manifest: %v", err)
+			}
+
+			status, message := readiness(obj)
+			if status != tt.expected {
+				t.Errorf("expected %v, received %v (%s)", tt.expected, status, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package plumber
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// WaveAnnotation sets the wave in which an object is applied. Waves are applied in
+	// ascending order and objects in a wave are only applied once all objects in the previous
+	// waves are ready. Objects without this annotation belong to wave 0.
+	WaveAnnotation = "plumber.io/wave"
+	// DependsOnAnnotation is a comma separated list of objects the annotated object depends
+	// on. Each entry has the format group/Kind/namespace/name, use "core" (or leave it empty)
+	// for the core group and leave the namespace empty for cluster wide objects. Objects are
+	// always applied in a wave after the wave of their dependencies, all dependencies must be
+	// part of the same overlay.
+	DependsOnAnnotation = "plumber.io/depends-on"
+)
+
+// strip removes, from the provided object, all annotations that are only meaningful for the
+// Renderer. These are not sent over to the API server.
+func strip(obj client.Object) {
+	annotations := obj.GetAnnotations()
+	if len(annotations) == 0 {
+		return
+	}
+
+	delete(annotations, WaveAnnotation)
+	delete(annotations, DependsOnAnnotation)
+	delete(annotations, HashAnnotation)
+	delete(annotations, IgnoreFieldsAnnotation)
+	delete(annotations, RecreateAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// dependencyKey returns the key used to identify an object in a DependsOnAnnotation.
+func dependencyKey(group, kind, namespace, name string) string {
+	if group == "core" {
+		group = ""
+	}
+	return strings.Join([]string{group, kind, namespace, name}, "/")
+}
+
+// dependencies parses the DependsOnAnnotation of the provided object.
+func dependencies(obj client.Object) ([]string, error) {
+	value := strings.TrimSpace(obj.GetAnnotations()[DependsOnAnnotation])
+	if value == "" {
+		return nil, nil
+	}
+
+	var deps []string
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "/")
+		if len(parts) != 4 || parts[1] == "" || parts[3] == "" {
+			return nil, fmt.Errorf("invalid dependency %q", entry)
+		}
+		deps = append(deps, dependencyKey(parts[0], parts[1], parts[2], parts[3]))
+	}
+	return deps, nil
+}
+
+// wave parses the WaveAnnotation of the provided object.
+func wave(obj client.Object) (int, error) {
+	value, ok := obj.GetAnnotations()[WaveAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	wave, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid wave %q: %w", value, err)
+	}
+	return wave, nil
+}
+
+// waves splits the provided objects into waves. The wave of an object is the one set in its
+// WaveAnnotation unless one of its dependencies lives in the same or in a later wave, in such
+// case the object is moved to the wave right after its last dependency. Waves are returned in
+// the order they must be applied and objects keep the order in which they were rendered.
+func (r *Renderer) waves(objs []client.Object) ([][]client.Object, error) {
+	index := map[string]int{}
+	for i, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, r.cli.Scheme())
+		if err != nil {
+			return nil, fmt.Errorf("error finding object kind: %w", err)
+		}
+
+		key := dependencyKey(gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName())
+		index[key] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	waves := make([]int, len(objs))
+	states := make([]int, len(objs))
+
+	var visit func(int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle found on %s", objs[i].GetName())
+		}
+		states[i] = visiting
+
+		obj := objs[i]
+		wave, err := wave(obj)
+		if err != nil {
+			return fmt.Errorf("error parsing wave for %s: %w", obj.GetName(), err)
+		}
+
+		deps, err := dependencies(obj)
+		if err != nil {
+			return fmt.Errorf("error parsing dependencies for %s: %w", obj.GetName(), err)
+		}
+
+		for _, dep := range deps {
+			j, ok := index[dep]
+			if !ok {
+				return fmt.Errorf("unknown dependency %q for %s", dep, obj.GetName())
+			}
+
+			if err := visit(j); err != nil {
+				return err
+			}
+
+			if waves[j] >= wave {
+				wave = waves[j] + 1
+			}
+		}
+
+		waves[i] = wave
+		states[i] = visited
+		return nil
+	}
+
+	groups := map[int][]client.Object{}
+	for i := range objs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+		groups[waves[i]] = append(groups[waves[i]], objs[i])
+	}
+
+	ids := make([]int, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	result := make([][]client.Object, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, groups[id])
+	}
+	return result, nil
+}
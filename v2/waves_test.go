@@ -0,0 +1,166 @@
+package plumber
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configMap returns a ConfigMap manifest with the provided name and annotations.
+func configMap(name string, annotations ...string) string {
+	manifest := fmt.Sprintf(
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n  namespace: default\n", name,
+	)
+	if len(annotations) == 0 {
+		return manifest
+	}
+
+	manifest += "  annotations:\n"
+	for i := 0; i < len(annotations); i += 2 {
+		manifest += fmt.Sprintf("    %s: %q\n", annotations[i], annotations[i+1])
+	}
+	return manifest
+}
+
+func TestWaves(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		manifests []string
+		expected  [][]string
+		err       string
+	}{
+		{
+			name: "no annotations",
+			manifests: []string{
+				configMap("a"),
+				configMap("b"),
+				configMap("c"),
+			},
+			expected: [][]string{{"a", "b", "c"}},
+		},
+		{
+			name: "explicit waves",
+			manifests: []string{
+				configMap("a", WaveAnnotation, "2"),
+				configMap("b", WaveAnnotation, "-1"),
+				configMap("c", WaveAnnotation, "0"),
+				configMap("d"),
+			},
+			expected: [][]string{{"b"}, {"c", "d"}, {"a"}},
+		},
+		{
+			name: "dependency in a later wave",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "core/ConfigMap/default/b"),
+				configMap("b", WaveAnnotation, "1"),
+			},
+			expected: [][]string{{"b"}, {"a"}},
+		},
+		{
+			name: "dependency in an earlier wave",
+			manifests: []string{
+				configMap(
+					"a",
+					WaveAnnotation, "3",
+					DependsOnAnnotation, "/ConfigMap/default/b",
+				),
+				configMap("b", WaveAnnotation, "1"),
+			},
+			expected: [][]string{{"b"}, {"a"}},
+		},
+		{
+			name: "chained dependencies",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "core/ConfigMap/default/b"),
+				configMap("b", DependsOnAnnotation, "core/ConfigMap/default/c"),
+				configMap("c"),
+				configMap("d"),
+			},
+			expected: [][]string{{"c", "d"}, {"b"}, {"a"}},
+		},
+		{
+			name: "multiple dependencies",
+			manifests: []string{
+				configMap(
+					"a",
+					DependsOnAnnotation, "core/ConfigMap/default/b, core/ConfigMap/default/c",
+				),
+				configMap("b", WaveAnnotation, "2"),
+				configMap("c"),
+			},
+			expected: [][]string{{"c"}, {"b"}, {"a"}},
+		},
+		{
+			name: "cycle",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "core/ConfigMap/default/b"),
+				configMap("b", DependsOnAnnotation, "core/ConfigMap/default/c"),
+				configMap("c", DependsOnAnnotation, "core/ConfigMap/default/a"),
+			},
+			err: "dependency cycle",
+		},
+		{
+			name: "self dependency",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "core/ConfigMap/default/a"),
+			},
+			err: "dependency cycle",
+		},
+		{
+			name: "unknown dependency",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "core/ConfigMap/default/b"),
+			},
+			err: "unknown dependency",
+		},
+		{
+			name: "invalid dependency",
+			manifests: []string{
+				configMap("a", DependsOnAnnotation, "ConfigMap/b"),
+			},
+			err: "invalid dependency",
+		},
+		{
+			name: "invalid wave",
+			manifests: []string{
+				configMap("a", WaveAnnotation, "first"),
+			},
+			err: "invalid wave",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := testRenderer(manifestFS(tt.manifests...))
+			objs, err := renderer.Render(context.Background(), "test")
+			if err != nil {
+				t.Fatalf("unexpected render error: %v", err)
+			}
+
+			waves, err := renderer.waves(objs)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, received %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names [][]string
+			for _, wave := range waves {
+				var wnames []string
+				for _, obj := range wave {
+					wnames = append(wnames, obj.GetName())
+				}
+				names = append(names, wnames)
+			}
+
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("expected waves %v, received %v", tt.expected, names)
+			}
+		})
+	}
+}